@@ -0,0 +1,149 @@
+package backport
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/Clever/microplane/git"
+)
+
+// Input for Backport
+type Input struct {
+	// RepoDir is where the cloned git repo lives. Its remote-tracking branches must include BaseBranch and CommitSHA.
+	RepoDir string
+	// WorkDir is where we will store some results:
+	//   - {WorkDir}/backported: stores a worktree of BaseBranch with CommitSHA cherry-picked onto it
+	WorkDir string
+	// CommitSHA is the merged commit to backport
+	CommitSHA string
+	// BaseBranch is the branch to backport onto, e.g. "release/1.2"
+	BaseBranch string
+	// BranchName where the cherry-picked commit will be made
+	BranchName string
+	// Git performs the cherry-pick
+	Git git.Git
+}
+
+// Output for Backport
+type Output struct {
+	Success bool
+
+	BackportDir string
+	BaseBranch  string
+	BranchName  string
+	// CommitSHA is the merged commit that was backported
+	CommitSHA string
+
+	// Pull request opened for the backport
+	PullRequestURL    string
+	PullRequestNumber int
+}
+
+// Backport cherry-picks a merged commit onto a branch, in a new worktree of the cloned repo
+func Backport(ctx context.Context, input Input) (Output, error) {
+	backportDir := path.Join(input.WorkDir, "backported")
+	if err := input.Git.RemoveWorktree(ctx, input.RepoDir, backportDir); err != nil {
+		return Output{Success: false}, fmt.Errorf("could not clear directory %s: %w", backportDir, err)
+	}
+	if err := input.Git.AddWorktree(ctx, input.RepoDir, backportDir, "origin/"+input.BaseBranch); err != nil {
+		return Output{Success: false}, err
+	}
+	if err := input.Git.CheckoutBranch(ctx, backportDir, input.BranchName); err != nil {
+		return Output{Success: false}, err
+	}
+	if err := input.Git.CherryPick(ctx, backportDir, input.CommitSHA); err != nil {
+		return Output{Success: false}, err
+	}
+
+	return Output{
+		Success:     true,
+		BackportDir: backportDir,
+		BaseBranch:  input.BaseBranch,
+		BranchName:  input.BranchName,
+		CommitSHA:   input.CommitSHA,
+	}, nil
+}
+
+// Source is a merged change that can be backported
+type Source struct {
+	// BaseBranch the change was planned against and merged into
+	BaseBranch string
+	// CommitSHA is the merge commit
+	CommitSHA string
+}
+
+// Target is a branch to backport onto, and the merged change to cherry-pick onto it
+type Target struct {
+	Branch string
+	Source Source
+}
+
+// Targets picks the merged change to backport onto each branch, so that a repo planned against several base
+// branches gets a single backport per branch: the change merged into the default branch, or else into the
+// latest base branch, ordered by version. Branches the change was planned against have their own pull requests,
+// and aren't backported onto.
+func Targets(branches, plannedBases []string, defaultBranch string, merged []Source) []Target {
+	if len(merged) == 0 {
+		return nil
+	}
+	latest := merged[0]
+	for _, m := range merged[1:] {
+		if latest.BaseBranch != defaultBranch && (m.BaseBranch == defaultBranch || versionLess(latest.BaseBranch, m.BaseBranch)) {
+			latest = m
+		}
+	}
+	targets := []Target{}
+	for _, branch := range branches {
+		if slices.Contains(plannedBases, branch) {
+			continue
+		}
+		targets = append(targets, Target{Branch: branch, Source: latest})
+	}
+	return targets
+}
+
+var numberRegexp = regexp.MustCompile(`\d+|\D+`)
+
+// LatestBranches returns the last n branches matching pattern, ordered by version, so that
+// "release/1.10" comes after "release/1.9". n <= 0 returns all matching branches.
+func LatestBranches(branches []string, pattern string, n int) ([]string, error) {
+	matches := []string{}
+	for _, branch := range branches {
+		ok, err := path.Match(pattern, branch)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, branch)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return versionLess(matches[i], matches[j])
+	})
+	if n > 0 && len(matches) > n {
+		matches = matches[len(matches)-n:]
+	}
+	return matches, nil
+}
+
+// versionLess compares runs of digits numerically and everything else lexically
+func versionLess(a, b string) bool {
+	as, bs := numberRegexp.FindAllString(a, -1), numberRegexp.FindAllString(b, -1)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		if aErr == nil && bErr == nil {
+			return an < bn
+		}
+		return as[i] < bs[i]
+	}
+	return len(as) < len(bs)
+}
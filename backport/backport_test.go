@@ -0,0 +1,45 @@
+package backport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatestBranches(t *testing.T) {
+	branches := []string{"main", "release/1.9", "release/1.10", "release/2.0", "release/1.2", "develop", "release/1.9.1"}
+
+	latest, err := LatestBranches(branches, "release/*", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"release/1.9.1", "release/1.10", "release/2.0"}, latest)
+
+	all, err := LatestBranches(branches, "release/*", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"release/1.2", "release/1.9", "release/1.9.1", "release/1.10", "release/2.0"}, all)
+
+	none, err := LatestBranches(branches, "hotfix/*", 3)
+	assert.NoError(t, err)
+	assert.Empty(t, none)
+
+	_, err = LatestBranches(branches, "release/[", 3)
+	assert.Error(t, err)
+}
+
+func TestTargets(t *testing.T) {
+	branches := []string{"release/1.9", "release/1.10", "release/2.0"}
+	merged := []Source{{"release/1.10", "aaa"}, {"main", "bbb"}, {"release/2.0", "ccc"}}
+
+	// each branch is backported onto once, from the default branch, and planned bases are skipped
+	targets := Targets(branches, []string{"main", "release/1.10", "release/2.0"}, "main", merged)
+	assert.Equal(t, []Target{{"release/1.9", Source{"main", "bbb"}}}, targets)
+
+	// without the default branch, from the latest merged base
+	targets = Targets(branches, []string{"release/1.10", "release/2.0"}, "main", []Source{{"release/2.0", "ccc"}, {"release/1.10", "aaa"}})
+	assert.Equal(t, []Target{{"release/1.9", Source{"release/2.0", "ccc"}}}, targets)
+
+	// a base that was planned against but not merged has its own pull request
+	targets = Targets(branches, []string{"main", "release/2.0"}, "main", []Source{{"main", "bbb"}})
+	assert.Equal(t, []Target{{"release/1.9", Source{"main", "bbb"}}, {"release/1.10", Source{"main", "bbb"}}}, targets)
+
+	assert.Empty(t, Targets(branches, []string{"main"}, "main", nil))
+}
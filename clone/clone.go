@@ -2,10 +2,10 @@ package clone
 
 import (
 	"context"
-	"fmt"
 	"os"
-	"os/exec"
 	"path"
+
+	"github.com/Clever/microplane/git"
 )
 
 type Input struct {
@@ -14,6 +14,8 @@ type Input struct {
 	WorkDir string
 	// GitURL to clone.
 	GitURL string
+	// Git performs the clone
+	Git git.Git
 }
 
 type Output struct {
@@ -21,15 +23,6 @@ type Output struct {
 	ClonedIntoDir string
 }
 
-type Error struct {
-	error
-	Details string
-}
-
-func (e Error) Error() string {
-	return fmt.Sprintf("%s:\n%s", e.error.Error(), e.Details)
-}
-
 func Clone(ctx context.Context, input Input) (Output, error) {
 	cloneIntoDir := path.Join(input.WorkDir, "cloned")
 	if _, err := os.Stat(cloneIntoDir); err == nil {
@@ -37,10 +30,8 @@ func Clone(ctx context.Context, input Input) (Output, error) {
 		return Output{Success: true, ClonedIntoDir: cloneIntoDir}, nil
 	}
 
-	cmd := exec.CommandContext(ctx, "git", "clone", input.GitURL, cloneIntoDir)
-	cmd.Dir = input.WorkDir
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return Output{Success: false}, Error{error: err, Details: string(output)}
+	if err := input.Git.Clone(ctx, input.GitURL, cloneIntoDir); err != nil {
+		return Output{Success: false}, err
 	}
 	return Output{Success: true, ClonedIntoDir: cloneIntoDir}, nil
 }
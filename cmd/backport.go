@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Clever/microplane/backport"
+	"github.com/Clever/microplane/clone"
+	"github.com/Clever/microplane/lib"
+	"github.com/Clever/microplane/merge"
+	"github.com/Clever/microplane/plan"
+	"github.com/Clever/microplane/push"
+	"github.com/spf13/cobra"
+)
+
+// CLI flags
+var backportFlagBranches string
+var backportFlagLast int
+var backportFlagAssignee string
+var backportFlagThrottle string
+var backportFlagLabels []string
+var backportFlagDraft bool
+
+// rate limits the # of backport PRs. used to prevent load on CI system
+var backportThrottle *time.Ticker
+
+var backportBranches string
+var backportLast int
+
+var backportCmd = &cobra.Command{
+	Use:   "backport",
+	Short: "Cherry-pick merged changes onto release branches",
+	Long: `Cherry-pick merged changes onto release branches.
+
+For each merged repo, the merge commit is cherry-picked onto every branch matching --branches
+(or only the latest --last of them), and a pull request is opened for each branch.
+A repo planned against several base branches (mp plan --base) is backported once per branch, from the change
+merged into its default branch, or else into its latest base branch. The base branches themselves are skipped.
+
+Cherry-picking requires the git binary.`,
+	Example: `mp backport --branches 'release/*' --last 2 -a my-github-user`,
+	Args:    cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		var err error
+		backportBranches, err = cmd.Flags().GetString("branches")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if backportBranches == "" {
+			log.Fatal("--branches is required")
+		}
+		if _, err := path.Match(backportBranches, ""); err != nil {
+			log.Fatalf("invalid --branches pattern: %s", err)
+		}
+
+		backportLast, err = cmd.Flags().GetInt("last")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		prAssignee, err = cmd.Flags().GetString("assignee")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if prAssignee == "" {
+			log.Fatal("--assignee is required")
+		}
+
+		throttle, err := cmd.Flags().GetString("throttle")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if throttle != "" {
+			// Try parsing it and updating the limiter
+			dur, err := time.ParseDuration(throttle)
+			if err != nil {
+				log.Fatalf("Error parsing --throttle flag: %s", err.Error())
+			}
+			backportThrottle = time.NewTicker(dur)
+		}
+
+		prLabels, err = cmd.Flags().GetStringSlice("labels")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		prDraft, err = cmd.Flags().GetBool("draft")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		repos, err := whichRepos(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// each repo is backported once, whatever base branches it was planned against, as they share its clone
+		err = parallelize(repos, backportOneRepo)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// backportOutputPath is where the state of backporting a repo's change onto one branch is stored
+func backportOutputPath(repoName, branch string) string {
+	return path.Join(workDir, repoName, "backport", lib.EscapeBranch(branch), "backport.json")
+}
+
+// backportSource is a change merged into one of the base branches a repo was planned against
+type backportSource struct {
+	target      lib.Repo
+	planOutput  plan.Output
+	mergeOutput merge.Output
+}
+
+func backportOneRepo(r lib.Repo, ctx context.Context) error {
+	log.Printf("%s/%s - backporting...", r.Owner, r.Name)
+
+	// Get previous steps' output, for each base branch the repo was planned against
+	targets, err := expandBaseBranches([]lib.Repo{r})
+	if err != nil {
+		return err
+	}
+	plannedBases := []string{}
+	merged := []backport.Source{}
+	sources := map[string]backportSource{}
+	defaultBranch := ""
+	for _, target := range targets {
+		var planOutput plan.Output
+		if loadJSON(outputPath(target.StateName(), "plan"), &planOutput) != nil {
+			continue
+		}
+		plannedBases = append(plannedBases, planOutput.BaseBranch)
+		defaultBranch = planOutput.Template.DefaultBranch
+		var mergeOutput merge.Output
+		if loadJSON(outputPath(target.StateName(), "merge"), &mergeOutput) != nil || !mergeOutput.Success || mergeOutput.MergeCommitSHA == "" {
+			continue
+		}
+		merged = append(merged, backport.Source{BaseBranch: planOutput.BaseBranch, CommitSHA: mergeOutput.MergeCommitSHA})
+		sources[planOutput.BaseBranch] = backportSource{target, planOutput, mergeOutput}
+	}
+	if len(merged) == 0 {
+		log.Printf("%s/%s - skipping, must successfully merge first", r.Owner, r.Name)
+		return nil
+	}
+	var cloneOutput clone.Output
+	if err := loadJSON(outputPath(r.Name, "clone"), &cloneOutput); err != nil {
+		return err
+	}
+
+	// The merge commits and the latest release branches are only known to the remote
+	if err := gitClient.Fetch(ctx, cloneOutput.ClonedIntoDir); err != nil {
+		return err
+	}
+	remoteBranches, err := gitClient.RemoteBranches(ctx, cloneOutput.ClonedIntoDir)
+	if err != nil {
+		return err
+	}
+	branches, err := backport.LatestBranches(remoteBranches, backportBranches, backportLast)
+	if err != nil {
+		return err
+	}
+
+	errs := []string{}
+	for _, t := range backport.Targets(branches, plannedBases, defaultBranch, merged) {
+		if err := backportOneBranch(ctx, r, t.Branch, sources[t.Source.BaseBranch], cloneOutput); err != nil {
+			errs = append(errs, fmt.Sprintf("%s/%s (%s): %s", r.Owner, r.Name, t.Branch, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, " | "))
+	}
+	return nil
+}
+
+func backportOneBranch(ctx context.Context, r lib.Repo, branch string, source backportSource, cloneOutput clone.Output) error {
+	// Exit early if already backported, from whichever base branch
+	backportOutputPath := backportOutputPath(r.Name, branch)
+	var backportOutput backport.Output
+	if loadJSON(backportOutputPath, &backportOutput) == nil && backportOutput.Success {
+		log.Printf("%s/%s - already backported to %s: %s", r.Owner, r.Name, branch, backportOutput.PullRequestURL)
+		return nil
+	}
+
+	// Prepare workdir for current step's output
+	backportWorkDir := filepath.Dir(backportOutputPath)
+	if err := os.MkdirAll(backportWorkDir, 0755); err != nil {
+		return err
+	}
+
+	// Execute
+	output, err := backport.Backport(ctx, backport.Input{
+		RepoDir:    cloneOutput.ClonedIntoDir,
+		WorkDir:    backportWorkDir,
+		CommitSHA:  source.mergeOutput.MergeCommitSHA,
+		BaseBranch: branch,
+		BranchName: fmt.Sprintf("%s-backport-%s", source.planOutput.BranchName, lib.EscapeBranch(branch)),
+		Git:        gitClient,
+	})
+	if err == nil {
+		var pushOutput push.Output
+		pushOutput, err = pushBackport(ctx, r, output, source.planOutput)
+		output.PullRequestURL = pushOutput.PullRequestURL
+		output.PullRequestNumber = pushOutput.PullRequestNumber
+		output.Success = err == nil
+	}
+	if err != nil {
+		output.BaseBranch = branch
+		output.CommitSHA = source.mergeOutput.MergeCommitSHA
+		o := struct {
+			backport.Output
+			Error string
+		}{output, err.Error()}
+		writeJSON(o, backportOutputPath)
+		return err
+	}
+	writeJSON(output, backportOutputPath)
+	log.Printf("%s/%s - backported %s to %s: %s", r.Owner, r.Name, source.target.StateName(), branch, output.PullRequestURL)
+	return nil
+}
+
+// pushBackport opens the pull request for a backport
+func pushBackport(ctx context.Context, r lib.Repo, output backport.Output, planOutput plan.Output) (push.Output, error) {
+	input := push.Input{
+		Repo:          r,
+		PlanDir:       output.BackportDir,
+		CommitMessage: fmt.Sprintf("[%s] %s", output.BaseBranch, planOutput.CommitMessage),
+		PRBody:        fmt.Sprintf("Backport of %s to `%s`.", output.CommitSHA, output.BaseBranch),
+		PRAssignee:    prAssignee,
+		BranchName:    output.BranchName,
+		BaseBranch:    output.BaseBranch,
+		Labels:        prLabels,
+		Draft:         prDraft,
+		Git:           gitClient,
+	}
+	if r.IsGitlab() {
+		return push.GitlabPush(ctx, input, repoLimiter, backportThrottle)
+	}
+	return push.GithubPush(ctx, input, repoLimiter, backportThrottle)
+}
+
+func init() {
+	backportCmd.Flags().StringVar(&backportFlagBranches, "branches", "", "Pattern of the branches to backport onto, e.g. 'release/*'")
+	backportCmd.Flags().IntVar(&backportFlagLast, "last", 0, "Only backport onto the latest N matching branches, ordered by version (default: all matching branches)")
+	backportCmd.Flags().StringVarP(&backportFlagThrottle, "throttle", "t", "30s", "Throttle number of backport PRs, e.g. '30s' means 1 PR per 30 seconds")
+	backportCmd.Flags().StringVarP(&backportFlagAssignee, "assignee", "a", "", "Github user to assign the PRs to")
+	backportCmd.Flags().StringSliceVarP(&backportFlagLabels, "labels", "l", nil, "Labels to attach to every backport PR, e.g. `-l backport -l 'release fix'`")
+	backportCmd.Flags().BoolVarP(&backportFlagDraft, "draft", "d", false, "open draft pull requests (only supported for github)")
+}
@@ -47,6 +47,7 @@ func cloneOneRepo(r lib.Repo, ctx context.Context) error {
 	input := clone.Input{
 		WorkDir: cloneWorkDir,
 		GitURL:  cloneURL,
+		Git:     gitClient,
 	}
 	output, err := clone.Clone(ctx, input)
 	if err != nil {
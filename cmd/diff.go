@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Clever/microplane/lib"
+	"github.com/Clever/microplane/plan"
+	"github.com/Clever/microplane/review"
+	"github.com/spf13/cobra"
+)
+
+var diffFlagGroup bool
+var diffFlagApprove []int
+var diffFlagReject []int
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show planned diffs",
+	Long: `Show planned diffs.
+
+With --group, repos whose diffs are identical, ignoring hunk offsets and the repo's owner and name
+(e.g. in paths), are grouped together. Each distinct diff is shown once, with its repos and size.
+Groups are numbered, largest first, so that whole groups can be approved or rejected as with mp review.`,
+	Example: `mp diff --group
+mp diff --group --approve 1,2 --reject 3`,
+	Args: cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		group, err := cmd.Flags().GetBool("group")
+		if err != nil {
+			log.Fatal(err)
+		}
+		approve, err := cmd.Flags().GetIntSlice("approve")
+		if err != nil {
+			log.Fatal(err)
+		}
+		reject, err := cmd.Flags().GetIntSlice("reject")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !group && len(approve)+len(reject) > 0 {
+			log.Fatal("--approve and --reject require --group")
+		}
+
+		repos, err := whichRepos(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		repos, err = expandBaseBranches(repos)
+		if err != nil {
+			log.Fatal(err)
+		}
+		planned := []review.Planned{}
+		byName := map[string]lib.Repo{}
+		for _, r := range repos {
+			var planOutput plan.Output
+			if loadJSON(outputPath(r.StateName(), "plan"), &planOutput) != nil || !planOutput.Success {
+				continue
+			}
+			name := fmt.Sprintf("%s/%s", r.Owner, r.StateName())
+			if !group {
+				// stream each diff, rather than reading them all
+				fmt.Println(name)
+				if err := copyDiff(os.Stdout, planOutput, true); err != nil {
+					log.Fatal(err)
+				}
+				fmt.Println()
+				continue
+			}
+			diff, err := planOutput.ReadDiff()
+			if err != nil {
+				log.Fatal(err)
+			}
+			byName[name] = r
+			planned = append(planned, review.Planned{Name: name, Owner: r.Owner, Repo: r.Name, Diff: diff, DiffSHA: planOutput.DiffSHA})
+		}
+		if !group {
+			return
+		}
+
+		groups := review.GroupDiffs(planned)
+		if len(approve)+len(reject) == 0 {
+			printGroups(groups)
+			return
+		}
+		decisions, err := groupDecisions(approve, reject, len(groups))
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, d := range decisions {
+			for _, p := range groups[d.group-1].Repos {
+				if err := writeReview(byName[p.Name], d.decision, p.DiffSHA); err != nil {
+					log.Fatal(err)
+				}
+			}
+			log.Printf("group %d: %s %d repos", d.group, d.decision, len(groups[d.group-1].Repos))
+		}
+	},
+}
+
+// groupDecision is a review decision on a group of diffs, numbered from 1
+type groupDecision struct {
+	group    int
+	decision string
+}
+
+// groupDecisions checks the groups to --approve and --reject, which can't overlap, and orders their decisions by group
+func groupDecisions(approve, reject []int, groups int) ([]groupDecision, error) {
+	decided := map[int]string{}
+	for _, d := range []struct {
+		decision string
+		numbers  []int
+	}{{review.Approved, approve}, {review.Rejected, reject}} {
+		decision := d.decision
+		for _, n := range d.numbers {
+			if n < 1 || n > groups {
+				return nil, fmt.Errorf("no group %d, there are %d groups", n, groups)
+			}
+			if previous, ok := decided[n]; ok && previous != decision {
+				return nil, fmt.Errorf("group %d is both approved and rejected", n)
+			}
+			decided[n] = decision
+		}
+	}
+	decisions := []groupDecision{}
+	for n, decision := range decided {
+		decisions = append(decisions, groupDecision{n, decision})
+	}
+	sort.Slice(decisions, func(i, j int) bool { return decisions[i].group < decisions[j].group })
+	return decisions, nil
+}
+
+func printGroups(groups []review.Group) {
+	for i, g := range groups {
+		names := []string{}
+		for _, p := range g.Repos {
+			names = append(names, p.Name)
+		}
+		fmt.Printf("=== Group %d: %d repo(s), %d file(s), +%d -%d\n", i+1, len(g.Repos), g.Files, g.Added, g.Deleted)
+		fmt.Printf("%s\n\n", strings.Join(names, ", "))
+		fmt.Printf("%s\n\n", review.Colorize(g.Repos[0].Diff))
+	}
+}
+
+// writeReview records a review decision on a repo's diff, identified by its plan.Output.DiffSHA
+func writeReview(r lib.Repo, decision, diffSHA string) error {
+	if diffSHA == "" {
+		// plans made before diffs were hashed can be read, but a decision on them couldn't be checked
+		return fmt.Errorf("%s/%s was planned by an older version of microplane, plan it again with --force to review it", r.Owner, r.StateName())
+	}
+	reviewOutputPath := outputPath(r.StateName(), "review")
+	if err := os.MkdirAll(filepath.Dir(reviewOutputPath), 0755); err != nil {
+		return err
+	}
+	return writeJSON(review.New(decision, diffSHA), reviewOutputPath)
+}
+
+// copyDiff streams a repo's planned diff to w, colored if asked to
+func copyDiff(w io.Writer, planOutput plan.Output, colored bool) error {
+	diff, err := planOutput.OpenDiff()
+	if err != nil {
+		return err
+	}
+	defer diff.Close()
+	if colored {
+		return review.CopyColorized(w, diff)
+	}
+	_, err = io.Copy(w, diff)
+	return err
+}
+
+func init() {
+	diffCmd.Flags().BoolVar(&diffFlagGroup, "group", false, "Group repos with identical diffs")
+	diffCmd.Flags().IntSliceVar(&diffFlagApprove, "approve", nil, "Approve the repos of these groups, as listed by --group")
+	diffCmd.Flags().IntSliceVar(&diffFlagReject, "reject", nil, "Reject the repos of these groups, as listed by --group")
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/Clever/microplane/review"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupDecisions(t *testing.T) {
+	decisions, err := groupDecisions([]int{3, 1, 1}, []int{2}, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []groupDecision{{1, review.Approved}, {2, review.Rejected}, {3, review.Approved}}, decisions)
+
+	_, err = groupDecisions([]int{1, 2}, []int{2}, 3)
+	assert.EqualError(t, err, "group 2 is both approved and rejected")
+
+	_, err = groupDecisions([]int{4}, nil, 3)
+	assert.EqualError(t, err, "no group 4, there are 3 groups")
+}
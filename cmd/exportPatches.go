@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/Clever/microplane/lib"
+	"github.com/Clever/microplane/plan"
+	"github.com/spf13/cobra"
+)
+
+var exportPatchesFlagOutput string
+var exportPatchesFlagMbox bool
+
+// these variables are set when the cmd starts running
+var (
+	exportDir      string
+	exportMbox     bool
+	exportManifest []patchManifestEntry
+	exportMu       sync.Mutex
+)
+
+// patchManifestEntry describes the patches exported for a repo
+type patchManifestEntry struct {
+	Repo       string
+	BaseBranch string
+	// BaseSHA is the commit the patches apply to
+	BaseSHA    string
+	BranchName string
+	// Patches, relative to the manifest, in the order to apply them
+	Patches []string
+}
+
+var exportPatchesCmd = &cobra.Command{
+	Use:   "export-patches",
+	Short: "Export planned changes as patch files",
+	Long: `Export planned changes as patch files.
+
+Each repo's planned commits are written with 'git format-patch' under <output>/<owner>/<repo>/,
+or as a single <output>/<owner>/<repo>.mbox with --mbox. They can be applied with 'git am'.
+<output>/manifest.json lists the patches of every repo, with the base branch and commit they apply to.
+
+Exporting requires the git binary.`,
+	Example: `mp export-patches -o patches
+mp export-patches --mbox`,
+	Args: cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			log.Fatal(err)
+		}
+		exportDir, err = filepath.Abs(output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		exportMbox, err = cmd.Flags().GetBool("mbox")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		repos, err := whichRepos(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		repos, err = expandBaseBranches(repos)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := exportPatches(repos); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("exported the patches of %d repos to %s", len(exportManifest), exportDir)
+	},
+}
+
+// exportPatches exports the patches of repos to exportDir, along with their manifest, which is written even if empty
+func exportPatches(repos []lib.Repo) error {
+	exportManifest = []patchManifestEntry{}
+	if err := parallelize(repos, exportOneRepo); err != nil {
+		return err
+	}
+
+	sort.Slice(exportManifest, func(i, j int) bool { return exportManifest[i].Patches[0] < exportManifest[j].Patches[0] })
+	if err := os.MkdirAll(exportDir, 0755); err != nil {
+		return err
+	}
+	return writeJSON(exportManifest, filepath.Join(exportDir, "manifest.json"))
+}
+
+func exportOneRepo(r lib.Repo, ctx context.Context) error {
+	var planOutput plan.Output
+	if loadJSON(outputPath(r.StateName(), "plan"), &planOutput) != nil || !planOutput.Success {
+		log.Printf("skipping %s/%s, must successfully plan first", r.Owner, r.StateName())
+		return nil
+	}
+
+	// clear patches exported previously, which may not match the plan anymore
+	repoDir := filepath.Join(exportDir, r.Owner, r.StateName())
+	mboxPath := repoDir + ".mbox"
+	for _, p := range []string{repoDir, mboxPath} {
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+
+	patches, err := gitClient.FormatPatch(ctx, planOutput.PlanDir, planOutput.BaseSHA, "HEAD", repoDir)
+	if err != nil {
+		return fmt.Errorf("%s/%s error: %w", r.Owner, r.StateName(), err)
+	}
+	if len(patches) == 0 {
+		log.Printf("skipping %s/%s, no commits to export", r.Owner, r.StateName())
+		return os.RemoveAll(repoDir)
+	}
+
+	// an mbox is the patches' emails concatenated
+	if exportMbox {
+		mbox := []byte{}
+		for _, p := range patches {
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			mbox = append(mbox, b...)
+		}
+		if err := os.WriteFile(mboxPath, mbox, 0644); err != nil {
+			return err
+		}
+		if err := os.RemoveAll(repoDir); err != nil {
+			return err
+		}
+		patches = []string{mboxPath}
+	}
+
+	entry := patchManifestEntry{
+		Repo:       fmt.Sprintf("%s/%s", r.Owner, r.Name),
+		BaseBranch: planOutput.BaseBranch,
+		BaseSHA:    planOutput.BaseSHA,
+		BranchName: planOutput.BranchName,
+	}
+	for _, p := range patches {
+		rel, err := filepath.Rel(exportDir, p)
+		if err != nil {
+			return err
+		}
+		entry.Patches = append(entry.Patches, rel)
+	}
+	exportMu.Lock()
+	exportManifest = append(exportManifest, entry)
+	exportMu.Unlock()
+	return nil
+}
+
+func init() {
+	exportPatchesCmd.Flags().StringVarP(&exportPatchesFlagOutput, "output", "o", "patches", "Directory to write the patches and manifest to")
+	exportPatchesCmd.Flags().BoolVar(&exportPatchesFlagMbox, "mbox", false, "Write a single mbox per repo instead of a patch file per commit")
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Clever/microplane/git"
+	"github.com/Clever/microplane/lib"
+	"github.com/Clever/microplane/plan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportPatches(t *testing.T) {
+	for _, v := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(v, "test")
+	}
+	for _, v := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(v, "test@example.com")
+	}
+	workDir = t.TempDir()
+	gitClient = &git.Exec{}
+	exportMbox = false
+
+	// a planned repo with one commit on top of its base, and a repo that wasn't planned
+	planDir := t.TempDir()
+	gitRun := func(args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", planDir}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	gitRun("init", "-b", "main")
+	gitRun("commit", "--allow-empty", "-m", "initial commit")
+	baseSHA := gitRun("rev-parse", "HEAD")
+	require.NoError(t, os.WriteFile(filepath.Join(planDir, "a.txt"), []byte("a\n"), 0644))
+	gitRun("add", ".")
+	gitRun("commit", "-m", "Add a")
+	require.NoError(t, os.MkdirAll(filepath.Dir(outputPath("app", "plan")), 0755))
+	require.NoError(t, writeJSON(plan.Output{Success: true, PlanDir: planDir, BaseBranch: "main", BaseSHA: baseSHA, BranchName: "add-a"}, outputPath("app", "plan")))
+	repos := []lib.Repo{{Owner: "clever", Name: "app"}, {Owner: "clever", Name: "unplanned"}}
+
+	exportDir = filepath.Join(t.TempDir(), "patches")
+	require.NoError(t, exportPatches(repos))
+	var manifest []patchManifestEntry
+	require.NoError(t, loadJSON(filepath.Join(exportDir, "manifest.json"), &manifest))
+	require.Len(t, manifest, 1)
+	assert.Equal(t, patchManifestEntry{
+		Repo:       "clever/app",
+		BaseBranch: "main",
+		BaseSHA:    baseSHA,
+		BranchName: "add-a",
+		Patches:    []string{"clever/app/0001-Add-a.patch"},
+	}, manifest[0])
+	patch, err := os.ReadFile(filepath.Join(exportDir, manifest[0].Patches[0]))
+	require.NoError(t, err)
+	assert.Contains(t, string(patch), "+a")
+
+	// with nothing to export, the manifest is still written
+	exportDir = filepath.Join(t.TempDir(), "patches")
+	require.NoError(t, exportPatches(repos[1:]))
+	require.NoError(t, loadJSON(filepath.Join(exportDir, "manifest.json"), &manifest))
+	assert.Empty(t, manifest)
+}
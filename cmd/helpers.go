@@ -5,9 +5,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 
+	"github.com/Clever/microplane/git"
 	"github.com/Clever/microplane/initialize"
 	"github.com/Clever/microplane/lib"
+	"github.com/Clever/microplane/plan"
 	"github.com/facebookgo/errgroup"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/semaphore"
@@ -57,29 +63,250 @@ func parallelizeLimited(repos []lib.Repo, f func(lib.Repo, context.Context) erro
 }
 
 // whichRepos determines which repos are relevant to the current command.
-// It also handles the `singleRepo` flag, allowing a user to target just one repo.
+// It resolves the repo selector flags, e.g. `--repo`, `--exclude` and `--only-failed`, against the targeted repos.
 func whichRepos(cmd *cobra.Command) ([]lib.Repo, error) {
 	var initOutput initialize.Output
 	if err := loadJSON(outputPath("", "init"), &initOutput); err != nil {
 		return []lib.Repo{}, err
 	}
 
-	singleRepo, err := cmd.Flags().GetString("repo")
+	var selector repoSelector
+	var err error
+	if selector.names, err = cmd.Flags().GetStringArray("repo"); err != nil {
+		return []lib.Repo{}, err
+	}
+	fromFile, err := cmd.Flags().GetString("from-file")
 	if err != nil {
 		return []lib.Repo{}, err
 	}
+	if fromFile != "" {
+		names, err := readRepoNames(fromFile)
+		if err != nil {
+			return []lib.Repo{}, err
+		}
+		selector.names = append(selector.names, names...)
+	}
+	if selector.exclude, err = cmd.Flags().GetStringArray("exclude"); err != nil {
+		return []lib.Repo{}, err
+	}
+	if selector.onlyFailed, err = cmd.Flags().GetBool("only-failed"); err != nil {
+		return []lib.Repo{}, err
+	}
+	if selector.onlyStatus, err = cmd.Flags().GetString("only-status"); err != nil {
+		return []lib.Repo{}, err
+	}
+	return selector.selectRepos(initOutput.Repos)
+}
+
+// repoStatuses are the statuses `--only-status` can filter on, in workflow order
+var repoStatuses = []string{"initialized", "cloned", "no-op", "planned", "pushed", "merged"}
+
+// repoSelector selects repos by name and workflow state
+type repoSelector struct {
+	// names or glob patterns, matched against the repo's name or owner/name. Empty selects every repo.
+	names []string
+	// exclude repos matching any of these names or patterns
+	exclude []string
+	// onlyFailed selects repos whose last step failed
+	onlyFailed bool
+	// onlyStatus selects repos with this status, as shown by `mp status`
+	onlyStatus string
+}
+
+func (s repoSelector) selectRepos(repos []lib.Repo) ([]lib.Repo, error) {
+	for _, pattern := range append(append([]string{}, s.names...), s.exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return []lib.Repo{}, fmt.Errorf("invalid repo pattern %s: %s", pattern, err)
+		}
+	}
+	if s.onlyStatus != "" && !contains(repoStatuses, s.onlyStatus) {
+		return []lib.Repo{}, fmt.Errorf("invalid --only-status %s, must be one of %s", s.onlyStatus, strings.Join(repoStatuses, ", "))
+	}
+
+	// every name that isn't a pattern must be a targeted repo
+	for _, name := range s.names {
+		if strings.ContainsAny(name, "*?[") {
+			continue
+		}
+		found := false
+		for _, r := range repos {
+			found = found || repoMatches(r, name)
+		}
+		if !found {
+			// TODO: showing valid repo names would be helpful
+			return []lib.Repo{}, fmt.Errorf("%s not a targeted repo name", name)
+		}
+	}
+
+	selected := []lib.Repo{}
+	for _, r := range repos {
+		if len(s.names) > 0 && !repoMatchesAny(r, s.names) {
+			continue
+		}
+		if repoMatchesAny(r, s.exclude) {
+			continue
+		}
+		if s.onlyFailed || s.onlyStatus != "" {
+			ok, err := s.matchesState(r)
+			if err != nil {
+				return []lib.Repo{}, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		selected = append(selected, r)
+	}
+	return selected, nil
+}
+
+// matchesState checks the repo's recorded step outputs. A repo planned against several base branches matches if any of them does.
+func (s repoSelector) matchesState(r lib.Repo) (bool, error) {
+	targets, err := expandBaseBranches([]lib.Repo{r})
+	if err != nil {
+		return false, err
+	}
+	for _, target := range targets {
+		status, _ := getRepoStatus(target)
+		if s.onlyStatus != "" && status != s.onlyStatus {
+			continue
+		}
+		if s.onlyFailed && !repoFailed(target) {
+			continue
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// repoFailed is whether a step of the repo recorded an error
+func repoFailed(r lib.Repo) bool {
+	for _, step := range []string{"clone", "plan", "push", "merge"} {
+		stateName := r.StateName()
+		if step == "clone" {
+			stateName = r.Name
+		}
+		var stepOutput struct {
+			Error string
+		}
+		if loadJSON(outputPath(stateName, step), &stepOutput) == nil && stepOutput.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func repoMatchesAny(r lib.Repo, patterns []string) bool {
+	for _, pattern := range patterns {
+		if repoMatches(r, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// repoMatches matches a name or glob pattern against the repo's name, or its owner/name if it has a '/'
+func repoMatches(r lib.Repo, pattern string) bool {
+	name := r.Name
+	if strings.Contains(pattern, "/") {
+		name = fmt.Sprintf("%s/%s", r.Owner, r.Name)
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// readRepoNames reads repo names or patterns from a file, one per line. Blank lines and '#' comments are ignored.
+func readRepoNames(file string) ([]string, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, line := range strings.Split(string(b), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			names = append(names, line)
+		}
+	}
+	return names, nil
+}
+
+// expandBaseBranches replaces each repo that was planned against several base branches
+// with one copy of the repo per base branch, so each can be pushed and merged separately.
+func expandBaseBranches(repos []lib.Repo) ([]lib.Repo, error) {
+	expanded := []lib.Repo{}
+	for _, r := range repos {
+		planPaths, err := filepath.Glob(outputPath(r.Name+"@*", "plan"))
+		if err != nil {
+			return nil, err
+		}
+		if len(planPaths) == 0 {
+			expanded = append(expanded, r)
+			continue
+		}
+		for _, planPath := range planPaths {
+			var planOutput plan.Output
+			if err := loadJSON(planPath, &planOutput); err != nil {
+				return nil, err
+			}
+			target := r
+			target.BaseBranch = planOutput.BaseBranch
+			expanded = append(expanded, target)
+		}
+	}
+	return expanded, nil
+}
 
-	// All repos
-	if singleRepo == "" {
-		return initOutput.Repos, nil
+// gitBackend returns the Git implementation selected by the `git-backend` flag.
+func gitBackend(cmd *cobra.Command) (git.Git, error) {
+	backend, err := cmd.Flags().GetString("git-backend")
+	if err != nil {
+		return nil, err
+	}
+	g, err := git.New(backend)
+	if err != nil {
+		return nil, err
+	}
+	// go-git can't use git's credential helpers, so authenticate https remotes with the provider's API token
+	if goGit, ok := g.(*git.GoGit); ok {
+		credentials := providerCredentials()
+		goGit.Credentials = func(host string) (string, string) {
+			c := credentials[host]
+			return c[0], c[1]
+		}
 	}
+	return g, nil
+}
 
-	// Single repo
-	for _, r := range initOutput.Repos {
-		if r.Name == singleRepo {
-			return []lib.Repo{r}, nil
+// providerCredentials maps the hosts of the providers to the username and API token to authenticate with,
+// so that each token is only sent to its own provider
+func providerCredentials() map[string][2]string {
+	configs := []lib.ProviderConfig{{Backend: "github"}, {Backend: "gitlab"}}
+	// enterprise providers have their own hosts
+	var initOutput initialize.Output
+	if err := loadJSON(outputPath("", "init"), &initOutput); err == nil {
+		for _, r := range initOutput.Repos {
+			configs = append(configs, r.ProviderConfig)
+		}
+	}
+	credentials := map[string][2]string{}
+	for _, pc := range configs {
+		host, err := pc.Hostname()
+		if err != nil {
+			continue
+		}
+		switch pc.Backend {
+		case "github":
+			if token := os.Getenv("GITHUB_API_TOKEN"); token != "" {
+				credentials[host] = [2]string{"x-access-token", token}
+			}
+		case "gitlab":
+			if token := os.Getenv("GITLAB_API_TOKEN"); token != "" {
+				credentials[host] = [2]string{"oauth2", token}
+			}
 		}
 	}
-	// TODO: showing valid repo names would be helpful
-	return []lib.Repo{}, fmt.Errorf("%s not a targeted repo name", singleRepo)
+	return credentials
 }
@@ -3,11 +3,16 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 
+	"github.com/Clever/microplane/clone"
 	"github.com/Clever/microplane/lib"
+	"github.com/Clever/microplane/plan"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var total = 0
@@ -41,3 +46,52 @@ func TestParallelize(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, len(repos), total)
 }
+
+func TestSelectRepos(t *testing.T) {
+	workDir = t.TempDir()
+	repos := []lib.Repo{
+		{Owner: "clever", Name: "app-api"},
+		{Owner: "clever", Name: "app-web"},
+		{Owner: "other", Name: "worker"},
+	}
+	for _, r := range repos {
+		require.NoError(t, os.MkdirAll(filepath.Dir(outputPath(r.Name, "clone")), 0755))
+		require.NoError(t, writeJSON(clone.Output{Success: true}, outputPath(r.Name, "clone")))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Dir(outputPath("app-web", "plan")), 0755))
+	require.NoError(t, writeJSON(struct {
+		plan.Output
+		Error string
+	}{Error: "exit status 1"}, outputPath("app-web", "plan")))
+
+	names := func(s repoSelector) []string {
+		selected, err := s.selectRepos(repos)
+		require.NoError(t, err)
+		names := []string{}
+		for _, r := range selected {
+			names = append(names, r.Name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"app-api", "app-web", "worker"}, names(repoSelector{}))
+	assert.Equal(t, []string{"app-api", "worker"}, names(repoSelector{names: []string{"worker", "app-api"}}))
+	assert.Equal(t, []string{"app-api", "app-web"}, names(repoSelector{names: []string{"app-*"}}))
+	assert.Equal(t, []string{"app-api", "app-web"}, names(repoSelector{names: []string{"clever/*"}}))
+	assert.Equal(t, []string{"app-api", "worker"}, names(repoSelector{exclude: []string{"*-web"}}))
+	assert.Equal(t, []string{"app-web"}, names(repoSelector{onlyFailed: true}))
+	assert.Equal(t, []string{"app-api", "app-web", "worker"}, names(repoSelector{onlyStatus: "cloned"}))
+	assert.Equal(t, []string{}, names(repoSelector{onlyStatus: "planned"}))
+
+	_, err := repoSelector{names: []string{"missing"}}.selectRepos(repos)
+	assert.ErrorContains(t, err, "missing not a targeted repo name")
+	_, err = repoSelector{onlyStatus: "done"}.selectRepos(repos)
+	assert.ErrorContains(t, err, "invalid --only-status")
+}
+
+func TestReadRepoNames(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "repos.txt")
+	require.NoError(t, os.WriteFile(file, []byte("app-api\n\n# failed last time\napp-web  # flaky\n"), 0644))
+	names, err := readRepoNames(file)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app-api", "app-web"}, names)
+}
@@ -25,6 +25,11 @@ where repos.txt has lines like:
 	clever/repo2
 	clever/repo2
 
+Lines may also set variables for the repo, which are passed to plan's command
+in the MICROPLANE_CONTEXT file:
+
+	clever/repo1 team=eng-apps tier=1
+
 ## (2) Init via Search
 
 ### GitHub Code Search
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/lib"
+	"github.com/Clever/microplane/plan"
+	"github.com/spf13/cobra"
+)
+
+// logStages are the workflow steps whose errors `mp logs` can show. Only plan keeps logs.
+var logStages = []string{"clone", "plan", "push", "merge"}
+
+var logsCmd = &cobra.Command{
+	Use:   "logs <repo> [step]",
+	Args:  cobra.RangeArgs(1, 2),
+	Short: "Show the logs of a repo's plan, or the full error of another step",
+	Long: `Show the logs of a repo's plan: the stdout and stderr of its change commands, followed by its full
+error, which mp status truncates.
+
+Only plan keeps logs. For clone, push and merge, which run no commands of yours, only the step's full
+error is shown. A repo planned against several base branches is named as in mp status,
+e.g. 'app-service@release%2F1.0', or with its base branch as is, e.g. 'app-service@release/1.0'.`,
+	Example: `mp logs app-service
+mp logs app-service push`,
+	Run: func(cmd *cobra.Command, args []string) {
+		stateName := args[0]
+		if name, base, ok := strings.Cut(stateName, "@"); ok {
+			if unescaped, err := url.PathUnescape(base); err == nil {
+				base = unescaped
+			}
+			stateName = lib.Repo{Name: name, BaseBranch: base}.StateName()
+		}
+		step := "plan"
+		if len(args) > 1 {
+			step = args[1]
+		}
+		found := false
+		for _, s := range logStages {
+			found = found || s == step
+		}
+		if !found {
+			log.Fatalf("invalid step %s, must be one of %s", step, strings.Join(logStages, ", "))
+		}
+
+		var initOutput initialize.Output
+		if err := loadJSON(outputPath("", "init"), &initOutput); err != nil {
+			log.Fatalf("must run init first: %s", err)
+		}
+		found = false
+		for _, r := range initOutput.Repos {
+			found = found || r.Name == strings.SplitN(stateName, "@", 2)[0]
+		}
+		if !found {
+			log.Fatalf("%s not a targeted repo name", stateName)
+		}
+
+		if err := printLogs(stateName, step); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// printLogs prints the log files of a repo's step, then the step's error
+func printLogs(stateName, step string) error {
+	stepOutputPath := outputPath(stateName, step)
+	if _, err := os.Stat(stepOutputPath); os.IsNotExist(err) {
+		return fmt.Errorf("%s has not run %s yet", stateName, step)
+	}
+
+	for _, name := range []string{plan.StdoutLog, plan.StderrLog} {
+		b, err := os.ReadFile(filepath.Join(filepath.Dir(stepOutputPath), name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		fmt.Printf("==> %s <==\n%s", name, b)
+		if len(b) > 0 && b[len(b)-1] != '\n' {
+			fmt.Println()
+		}
+	}
+
+	var stepOutput struct {
+		Error string
+	}
+	if err := loadJSON(stepOutputPath, &stepOutput); err != nil {
+		return err
+	}
+	if stepOutput.Error != "" {
+		fmt.Printf("==> error <==\n%s\n", stepOutput.Error)
+	}
+	return nil
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/Clever/microplane/lib"
 	"github.com/Clever/microplane/merge"
+	"github.com/Clever/microplane/plan"
 	"github.com/Clever/microplane/push"
 	"github.com/spf13/cobra"
 )
@@ -36,6 +37,10 @@ var mergeCmd = &cobra.Command{
 		if err != nil {
 			log.Fatal(err)
 		}
+		repos, err = expandBaseBranches(repos)
+		if err != nil {
+			log.Fatal(err)
+		}
 
 		throttle, err := cmd.Flags().GetString("throttle")
 		if err != nil {
@@ -62,22 +67,29 @@ var mergeCmd = &cobra.Command{
 }
 
 func mergeOneRepo(r lib.Repo, ctx context.Context) error {
-	log.Printf("%s/%s - merging...", r.Owner, r.Name)
+	log.Printf("%s/%s - merging...", r.Owner, r.StateName())
 
 	// Exit early if already merged
 	var mergeOutput struct {
 		merge.Output
 		Error string
 	}
-	if loadJSON(outputPath(r.Name, "merge"), &mergeOutput) == nil && mergeOutput.Success {
-		log.Printf("%s/%s - already merged", r.Owner, r.Name)
+	if loadJSON(outputPath(r.StateName(), "merge"), &mergeOutput) == nil && mergeOutput.Success {
+		log.Printf("%s/%s - already merged", r.Owner, r.StateName())
+		return nil
+	}
+
+	// A re-plan that made no changes supersedes an earlier push
+	var planOutput plan.Output
+	if loadJSON(outputPath(r.StateName(), "plan"), &planOutput) == nil && planOutput.NoOp {
+		log.Printf("%s/%s - skipping, plan made no changes", r.Owner, r.StateName())
 		return nil
 	}
 
 	// Get previous step's output
 	var pushOutput push.Output
-	if loadJSON(outputPath(r.Name, "push"), &pushOutput) != nil || !pushOutput.Success {
-		log.Printf("%s/%s - skipping, must successfully push first", r.Owner, r.Name)
+	if loadJSON(outputPath(r.StateName(), "push"), &pushOutput) != nil || !pushOutput.Success {
+		log.Printf("%s/%s - skipping, must successfully push first", r.Owner, r.StateName())
 		return nil
 	}
 	segments := strings.Split(pushOutput.PullRequestURL, "/")
@@ -87,7 +99,7 @@ func mergeOneRepo(r lib.Repo, ctx context.Context) error {
 	}
 
 	// Prepare workdir for current step's output
-	mergeOutputPath := outputPath(r.Name, "merge")
+	mergeOutputPath := outputPath(r.StateName(), "merge")
 	mergeWorkDir := filepath.Dir(mergeOutputPath)
 	if err := os.MkdirAll(mergeWorkDir, 0755); err != nil {
 		return err
@@ -111,7 +123,7 @@ func mergeOneRepo(r lib.Repo, ctx context.Context) error {
 		log.Fatal("Provider must be github or gitlab")
 	}
 	if err != nil {
-		log.Printf("%s/%s - merge error: %s", r.Owner, r.Name, err.Error())
+		log.Printf("%s/%s - merge error: %s", r.Owner, r.StateName(), err.Error())
 		o := struct {
 			merge.Output
 			Error string
@@ -2,16 +2,23 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/Clever/microplane/clone"
+	"github.com/Clever/microplane/git"
+	"github.com/Clever/microplane/initialize"
 	"github.com/Clever/microplane/lib"
 	"github.com/Clever/microplane/merge"
 	"github.com/Clever/microplane/plan"
+	"github.com/Clever/microplane/push"
 	"github.com/spf13/cobra"
 )
 
@@ -20,78 +27,284 @@ var planFlagDiff bool
 var planFlagMessage string
 var planFlagParallelism int64
 var planAllowEmptyCommit bool
+var planFlagBase string
+var planFlagCampaign string
+var planFlagTimeout time.Duration
+var planFlagCPULimit time.Duration
+var planFlagMemoryLimit int64
+var planFlagSandbox string
+var planFlagSandboxNetwork bool
+var planFlagSandboxImage string
+var planFlagSandboxRuntime string
+var planFlagStarlark string
+var planFlagPatch string
+var planFlagForce bool
+var planFlagValidate []string
+var planFlagAuthor string
+var planFlagCommitter string
+var planFlagSignoff bool
+var planFlagCoAuthors []string
+var planFlagTrailers []string
+var planFlagSign string
+var planFlagSigningKey string
 
 // TODO: Pass these *not* via globals
 // these variables are set when the cmd starts running
 var (
-	allowEmptyCommit bool
-	branchName       string
-	commitMessage    string
-	changeCmd        string
-	changeCmdArgs    []string
-	isSingleRepo     bool
-	showDiff         bool
+	allowEmptyCommit  bool
+	baseBranchPattern string
+	branchName        string
+	campaign          string
+	commitMessage     string
+	changeCmd         string
+	changeCmdArgs     []string
+	changeCmdLimits   plan.Limits
+	changeCmdSandbox  plan.Sandbox
+	changeCmdTimeout  time.Duration
+	changeOperation   plan.Operation
+	changeSteps       []plan.Step
+	changeValidate    []string
+	commitAuthor      git.Identity
+	commitCommitter   git.Identity
+	commitSignoff     bool
+	commitTrailers    []string
+	commitSigning     git.Signing
+	forcePlan         bool
+	isSingleRepo      bool
+	repoVars          map[string]map[string]string
+	showDiff          bool
 )
 
 var planCmd = &cobra.Command{
-	Use:   "plan [cmd] [args...]",
-	Args:  cobra.MinimumNArgs(1),
+	Use: "plan [cmd] [args...]",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if cmd.Flags().Changed("starlark") || cmd.Flags().Changed("patch") {
+			return cobra.ExactArgs(0)(cmd, args)
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
 	Short: "Plan changes by running a command against cloned repos",
 	Example: `mp plan -b microplaning -m 'microplane fun' -r app-service -- sh -c /absolute/path/to/script
-mp plan -b microplaning -m 'microplane fun' -r app-service -- python /absolute/path/to/script`,
+mp plan -b microplaning -m 'microplane fun' -r app-service -- python /absolute/path/to/script
+mp plan -b microplaning -m 'microplane fun' --base 'release/*' -- sh -c /absolute/path/to/script
+mp plan -b microplaning -m 'microplane fun' --starlark change.star
+mp plan -b microplaning -m 'microplane fun' --patch /absolute/path/to/change.patch`,
 	Run: func(cmd *cobra.Command, args []string) {
-		var err error
-		var parallelismLimit int64
-
-		changeCmd = args[0]
-		if len(args) > 1 {
-			changeCmdArgs = args[1:]
-		}
-
-		branchName, err = cmd.Flags().GetString("branch")
+		starlarkPath, err := cmd.Flags().GetString("starlark")
 		if err != nil {
 			log.Fatal(err)
 		}
-		if branchName == "" {
-			log.Fatal("--branch is required")
-		}
-
-		diff, err := cmd.Flags().GetBool("diff")
+		patchPath, err := cmd.Flags().GetString("patch")
 		if err != nil {
 			log.Fatal(err)
 		}
-		showDiff = diff
-
-		commitMessage, err = cmd.Flags().GetString("message")
-		if err != nil {
-			log.Fatal(err)
+		if starlarkPath != "" && patchPath != "" {
+			log.Fatal("--starlark and --patch can't be used together")
 		}
-		if commitMessage == "" {
-			log.Fatal("--message is required")
+		if starlarkPath != "" {
+			changeOperation, err = plan.NewStarlark(starlarkPath)
+			if err != nil {
+				log.Fatalf("invalid --starlark: %s", err)
+			}
+		} else if patchPath != "" {
+			changeOperation, err = plan.NewPatch(patchPath)
+			if err != nil {
+				log.Fatalf("invalid --patch: %s", err)
+			}
+		} else {
+			changeCmd = args[0]
+			if len(args) > 1 {
+				changeCmdArgs = args[1:]
+			}
 		}
 
-		repos, err := whichRepos(cmd)
-		if err != nil {
-			log.Fatal(err)
-		}
-		isSingleRepo = len(repos) == 1
+		runPlan(cmd)
+	},
+}
 
-		parallelismLimit, err = cmd.Flags().GetInt64("parallelism")
-		if err != nil {
-			log.Fatal(err)
+// runPlan plans the change in every repo, with the flags shared by `mp plan` and its subcommands
+func runPlan(cmd *cobra.Command) {
+	var err error
+	var parallelismLimit int64
+
+	branchName, err = cmd.Flags().GetString("branch")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if branchName == "" {
+		log.Fatal("--branch is required")
+	}
+
+	diff, err := cmd.Flags().GetBool("diff")
+	if err != nil {
+		log.Fatal(err)
+	}
+	showDiff = diff
+
+	commitMessage, err = cmd.Flags().GetString("message")
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the steps of a recipe may commit everything with their own messages
+	if commitMessage == "" && (len(changeSteps) == 0 || changeSteps[len(changeSteps)-1].Message == "") {
+		log.Fatal("--message is required, unless the last step of the recipe has a message")
+	}
+	for name, text := range map[string]string{"--branch": branchName, "--message": commitMessage} {
+		if err := plan.CheckTemplate(name, text); err != nil {
+			log.Fatalf("invalid %s template: %s", name, err)
 		}
+	}
+	for i, step := range changeSteps {
+		if err := plan.CheckTemplate("message", step.Message); err != nil {
+			log.Fatalf("invalid message template of step %d: %s", i+1, err)
+		}
+	}
+
+	repos, err := whichRepos(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	isSingleRepo = len(repos) == 1
+
+	parallelismLimit, err = cmd.Flags().GetInt64("parallelism")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	allowEmptyCommit, err = cmd.Flags().GetBool("allow-empty-commit")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	changeCmdTimeout, err = cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		log.Fatal(err)
+	}
+	changeCmdLimits.CPU, err = cmd.Flags().GetDuration("cpu-limit")
+	if err != nil {
+		log.Fatal(err)
+	}
+	memoryLimitMiB, err := cmd.Flags().GetInt64("memory-limit")
+	if err != nil {
+		log.Fatal(err)
+	}
+	changeCmdLimits.MemoryBytes = memoryLimitMiB * 1024 * 1024
+
+	changeCmdSandbox.Mode, err = cmd.Flags().GetString("sandbox")
+	if err != nil {
+		log.Fatal(err)
+	}
+	changeCmdSandbox.Network, err = cmd.Flags().GetBool("sandbox-network")
+	if err != nil {
+		log.Fatal(err)
+	}
+	changeCmdSandbox.Image, err = cmd.Flags().GetString("sandbox-image")
+	if err != nil {
+		log.Fatal(err)
+	}
+	changeCmdSandbox.Runtime, err = cmd.Flags().GetString("sandbox-runtime")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := changeCmdSandbox.Validate(); err != nil {
+		log.Fatalf("invalid --sandbox: %s", err)
+	}
 
-		allowEmptyCommit, err = cmd.Flags().GetBool("allow-empty-commit")
+	baseBranchPattern, err = cmd.Flags().GetString("base")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := path.Match(baseBranchPattern, ""); err != nil {
+		log.Fatalf("invalid --base pattern: %s", err)
+	}
+
+	campaign, err = cmd.Flags().GetString("campaign")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	changeValidate, err = cmd.Flags().GetStringArray("validate")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	forcePlan, err = cmd.Flags().GetBool("force")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for flag, identity := range map[string]*git.Identity{"author": &commitAuthor, "committer": &commitCommitter} {
+		value, err := cmd.Flags().GetString(flag)
 		if err != nil {
 			log.Fatal(err)
 		}
+		if value == "" {
+			continue
+		}
+		if *identity, err = git.ParseIdentity(value); err != nil {
+			log.Fatalf("invalid --%s: %s", flag, err)
+		}
+	}
+
+	commitSignoff, err = cmd.Flags().GetBool("signoff")
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		log.Printf("planning %d repos with parallelism limit [%d]", len(repos), parallelismLimit)
-		err = parallelizeLimited(repos, planOneRepo, parallelismLimit)
+	coAuthors, err := cmd.Flags().GetStringArray("co-author")
+	if err != nil {
+		log.Fatal(err)
+	}
+	commitTrailers = []string{}
+	for _, coAuthor := range coAuthors {
+		identity, err := git.ParseIdentity(coAuthor)
 		if err != nil {
-			log.Fatalf("%d errors:\n %+v\n", strings.Count(err.Error(), " | ")+1, err)
+			log.Fatalf("invalid --co-author: %s", err)
 		}
-	},
+		commitTrailers = append(commitTrailers, "Co-authored-by: "+identity.String())
+	}
+	trailers, err := cmd.Flags().GetStringArray("trailer")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, trailer := range trailers {
+		if key, value, ok := strings.Cut(trailer, ": "); !ok || key == "" || strings.ContainsAny(key, " \t") || value == "" {
+			log.Fatalf("invalid --trailer '%s', must be 'Key: value'", trailer)
+		}
+		commitTrailers = append(commitTrailers, trailer)
+	}
+
+	commitSigning.Format, err = cmd.Flags().GetString("sign")
+	if err != nil {
+		log.Fatal(err)
+	}
+	commitSigning.Key, err = cmd.Flags().GetString("signing-key")
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch commitSigning.Format {
+	case "", git.SignGPG, git.SignSSH:
+	default:
+		log.Fatalf("invalid --sign '%s', must be '%s' or '%s'", commitSigning.Format, git.SignGPG, git.SignSSH)
+	}
+	if commitSigning.Key != "" && commitSigning.Format == "" {
+		log.Fatal("--signing-key requires --sign")
+	}
+	if _, ok := gitClient.(*git.GoGit); ok && commitSigning.Format != "" {
+		log.Fatalf("--sign requires the git binary, use --git-backend=%s", git.BackendExec)
+	}
+
+	var initOutput initialize.Output
+	if err := loadJSON(outputPath("", "init"), &initOutput); err != nil {
+		log.Fatal(err)
+	}
+	repoVars = initOutput.Vars
+
+	log.Printf("planning %d repos with parallelism limit [%d]", len(repos), parallelismLimit)
+	err = parallelizeLimited(repos, planOneRepo, parallelismLimit)
+	if err != nil {
+		log.Fatalf("%d errors:\n %+v\n", strings.Count(err.Error(), " | ")+1, err)
+	}
 }
 
 func planOneRepo(r lib.Repo, ctx context.Context) error {
@@ -104,54 +317,230 @@ func planOneRepo(r lib.Repo, ctx context.Context) error {
 		return nil
 	}
 
+	targets, err := planTargets(ctx, r, cloneOutput.ClonedIntoDir)
+	if err != nil {
+		return fmt.Errorf("%s/%s error: %+v", r.Owner, r.Name, err)
+	}
+	if len(targets) == 0 {
+		log.Printf("skipping %s/%s, no branch matches --base %s", r.Owner, r.Name, baseBranchPattern)
+		return nil
+	}
+	if err := clearStaleTargets(ctx, r, cloneOutput.ClonedIntoDir, targets); err != nil {
+		return fmt.Errorf("%s/%s error: %+v", r.Owner, r.Name, err)
+	}
+
+	errs := []string{}
+	for _, target := range targets {
+		if err := planOneTarget(ctx, target, cloneOutput); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, " | "))
+	}
+	return nil
+}
+
+// planTarget is one base branch of a repo to plan against
+type planTarget struct {
+	repo       lib.Repo
+	baseBranch string
+	branchName string
+}
+
+// planTargets resolves the `--base` flag against the repo's branches.
+// A pattern matching several branches produces one target per branch, each with its own workflow state and branch name,
+// which are both named after the base branch escaped the same way, so that no two targets share them.
+func planTargets(ctx context.Context, r lib.Repo, cloneDir string) ([]planTarget, error) {
+	if !strings.ContainsAny(baseBranchPattern, "*?[") {
+		return []planTarget{{repo: r, baseBranch: baseBranchPattern, branchName: branchName}}, nil
+	}
+
+	branches, err := gitClient.RemoteBranches(ctx, cloneDir)
+	if err != nil {
+		return nil, err
+	}
+	matches := []string{}
+	for _, branch := range branches {
+		if ok, err := path.Match(baseBranchPattern, branch); err != nil {
+			return nil, err
+		} else if ok {
+			matches = append(matches, branch)
+		}
+	}
+	if len(matches) == 1 {
+		return []planTarget{{repo: r, baseBranch: matches[0], branchName: branchName}}, nil
+	}
+
+	sort.Strings(matches)
+	targets := []planTarget{}
+	for _, base := range matches {
+		target := r
+		target.BaseBranch = base
+		targets = append(targets, planTarget{
+			repo:       target,
+			baseBranch: base,
+			branchName: fmt.Sprintf("%s-%s", branchName, lib.EscapeBranch(base)),
+		})
+	}
+	return targets, nil
+}
+
+// clearStaleTargets removes the state of a previous plan against base branches that are no longer targeted,
+// so that push doesn't pick them up. Targets that have already been pushed are never removed.
+func clearStaleTargets(ctx context.Context, r lib.Repo, cloneDir string, targets []planTarget) error {
+	current := map[string]bool{}
+	for _, target := range targets {
+		current[target.repo.StateName()] = true
+	}
+
+	stale := []lib.Repo{}
+	if !current[r.Name] {
+		stale = append(stale, r)
+	}
+	multiBase, err := expandBaseBranches([]lib.Repo{r})
+	if err != nil {
+		return err
+	}
+	for _, target := range multiBase {
+		if target.BaseBranch != "" && !current[target.StateName()] {
+			stale = append(stale, target)
+		}
+	}
+
+	for _, target := range stale {
+		var pushOutput push.Output
+		if loadJSON(outputPath(target.StateName(), "push"), &pushOutput) == nil && pushOutput.Success {
+			return fmt.Errorf("previously planned and pushed %s, which is not targeted anymore. Remove %s to plan anyway", target.StateName(), filepath.Dir(filepath.Dir(outputPath(target.StateName(), "push"))))
+		}
+		planWorkDir := filepath.Dir(outputPath(target.StateName(), "plan"))
+		if err := gitClient.RemoveWorktree(ctx, cloneDir, filepath.Join(planWorkDir, "planned")); err != nil {
+			return err
+		}
+		// a base branch's state lives in its own directory, while the repo's own directory also holds the clone
+		stateDir := planWorkDir
+		if target.BaseBranch != "" {
+			stateDir = filepath.Dir(planWorkDir)
+		}
+		if err := os.RemoveAll(stateDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func planOneTarget(ctx context.Context, target planTarget, cloneOutput clone.Output) error {
+	r := target.repo
+
 	// Exit early if already merged
 	var mergeOutput struct {
 		merge.Output
 		Error string
 	}
-	if loadJSON(outputPath(r.Name, "merge"), &mergeOutput) == nil && mergeOutput.Success {
-		log.Printf("%s/%s - already merged", r.Owner, r.Name)
+	if loadJSON(outputPath(r.StateName(), "merge"), &mergeOutput) == nil && mergeOutput.Success {
+		log.Printf("%s/%s - already merged", r.Owner, r.StateName())
 		return nil
 	}
 
 	// Prepare workdir for current step's output
-	planOutputPath := outputPath(r.Name, "plan")
+	planOutputPath := outputPath(r.StateName(), "plan")
 	planWorkDir := filepath.Dir(planOutputPath)
 	if err := os.MkdirAll(planWorkDir, 0755); err != nil {
 		return err
 	}
 
+	var previousOutput plan.Output
+	loadJSON(planOutputPath, &previousOutput)
+
 	// Execute
 	input := plan.Input{
-		RepoName:         r.Name,
+		Repo:             r,
 		RepoDir:          cloneOutput.ClonedIntoDir,
 		WorkDir:          planWorkDir,
 		Command:          plan.Command{Path: changeCmd, Args: changeCmdArgs},
+		Operation:        changeOperation,
+		Steps:            changeSteps,
+		Validate:         changeValidate,
 		CommitMessage:    commitMessage,
-		BranchName:       branchName,
+		BranchName:       target.branchName,
+		BaseBranch:       target.baseBranch,
+		Campaign:         campaign,
+		Vars:             repoVars[fmt.Sprintf("%s/%s", r.Owner, r.Name)],
 		AllowEmptyCommit: allowEmptyCommit,
+		Author:           commitAuthor,
+		Committer:        commitCommitter,
+		Signoff:          commitSignoff,
+		Trailers:         commitTrailers,
+		Signing:          commitSigning,
+		Timeout:          changeCmdTimeout,
+		Limits:           changeCmdLimits,
+		Sandbox:          changeCmdSandbox,
+		Git:              gitClient,
+		Previous:         previousOutput,
+		Force:            forcePlan,
 	}
 	output, err := plan.Plan(ctx, input)
 	if err != nil {
+		// keep track of the base branch, so this target is found again by expandBaseBranches
+		if output.BaseBranch == "" {
+			output.BaseBranch = r.BaseBranch
+		}
 		o := struct {
 			plan.Output
 			Error string
 		}{output, err.Error()}
 		writeJSON(o, planOutputPath)
-		return fmt.Errorf("%s/%s error: %+v", r.Owner, r.Name, err)
+		return fmt.Errorf("%s/%s error: %+v", r.Owner, r.StateName(), err)
 	}
 	writeJSON(output, planOutputPath)
+	if output.UpToDate {
+		log.Printf("%s/%s - unchanged since the last plan, use --force to plan again", r.Owner, r.StateName())
+	}
+	if output.SkipReason != "" {
+		log.Printf("skipping %s/%s, %s", r.Owner, r.StateName(), output.SkipReason)
+		return nil
+	}
+	if output.NoOp {
+		log.Printf("%s/%s - no changes", r.Owner, r.StateName())
+		return nil
+	}
+	if failed := output.FailedValidations(); len(failed) > 0 {
+		log.Printf("%s/%s - failed validation: %s", r.Owner, r.StateName(), strings.Join(failed, ", "))
+	}
 	if showDiff {
-		log.Printf("diffing: %s/%s", r.Owner, r.Name)
-		fmt.Println(output.GitDiff)
+		log.Printf("diffing: %s/%s", r.Owner, r.StateName())
+		if err := copyDiff(os.Stdout, output, false); err != nil {
+			return err
+		}
+		fmt.Println()
 	}
 	return nil
 }
 
 func init() {
-	planCmd.Flags().StringVarP(&planFlagBranch, "branch", "b", "", "Git branch to commit to")
-	planCmd.Flags().BoolVarP(&planFlagDiff, "diff", "d", false, "Show the diffs of the changes made per repo")
-	planCmd.Flags().StringVarP(&planFlagMessage, "message", "m", "", "Commit message")
-	planCmd.Flags().Int64VarP(&planFlagParallelism, "parallelism", "p", defaultParallelism, "Parallelism limit")
-	planCmd.Flags().BoolVarP(&planAllowEmptyCommit, "allow-empty-commit", "e", false, "Commit even if no changes were made")
+	planCmd.PersistentFlags().StringVarP(&planFlagBranch, "branch", "b", "", "Git branch to commit to. A Go template, e.g. 'bump-{{.Repo}}'")
+	planCmd.PersistentFlags().BoolVarP(&planFlagDiff, "diff", "d", false, "Show the diffs of the changes made per repo")
+	planCmd.PersistentFlags().StringVarP(&planFlagMessage, "message", "m", "", "Commit message. A Go template, e.g. 'Bump foo to {{.Values.version}} in {{.Repo}}'")
+	planCmd.PersistentFlags().Int64VarP(&planFlagParallelism, "parallelism", "p", defaultParallelism, "Parallelism limit")
+	planCmd.PersistentFlags().BoolVarP(&planAllowEmptyCommit, "allow-empty-commit", "e", false, "Commit even if no changes were made")
+	planCmd.PersistentFlags().StringVar(&planFlagBase, "base", "", "Base branch to plan against, or a pattern such as 'release/*' to plan against every matching branch, each on a branch named after --branch and the base, e.g. my-change-release%2F1.0 (default: the repo's default branch)")
+	planCmd.PersistentFlags().StringVar(&planFlagCampaign, "campaign", "", "Name of the campaign the change is part of, passed to the command as MICROPLANE_CAMPAIGN (default: the branch name)")
+	planCmd.PersistentFlags().DurationVar(&planFlagTimeout, "timeout", 0, "Stop the change, its commands, scripts and validation, if it runs longer than this in a repo, e.g. '5m' (default: no timeout)")
+	planCmd.PersistentFlags().DurationVar(&planFlagCPULimit, "cpu-limit", 0, "Limit the CPU time the command may use in a repo, e.g. '2m' (default: no limit)")
+	planCmd.PersistentFlags().Int64Var(&planFlagMemoryLimit, "memory-limit", 0, "Limit the virtual memory the command may use in a repo, in MiB (default: no limit)")
+	planCmd.PersistentFlags().StringVar(&planFlagSandbox, "sandbox", plan.SandboxNone, "Isolate the command: 'none', 'env' (strip secrets from the env, HOME and TMPDIR in the plan dir), 'namespace' (also hidden home dirs, read-only filesystem outside the plan dir and no network, with bwrap) or 'container' (also run in --sandbox-image)")
+	planCmd.PersistentFlags().BoolVar(&planFlagSandboxNetwork, "sandbox-network", false, "Allow network access in the 'namespace' and 'container' sandboxes")
+	planCmd.PersistentFlags().StringVar(&planFlagSandboxImage, "sandbox-image", "", "Image to run the command in, for the 'container' sandbox")
+	planCmd.PersistentFlags().StringVar(&planFlagSandboxRuntime, "sandbox-runtime", "docker", "Container runtime CLI for the 'container' sandbox, e.g. 'docker' or 'podman'")
+	planCmd.PersistentFlags().BoolVar(&planFlagForce, "force", false, "Plan repos again even if nothing changed since their last successful plan: base commit, command, script, recipe or message")
+	planCmd.PersistentFlags().StringArrayVar(&planFlagValidate, "validate", nil, "Check the change with a shell command run in each repo after committing, e.g. 'go build ./...'. Repos failing a check are not pushed, unless with 'mp push --force'")
+	planCmd.PersistentFlags().StringVar(&planFlagAuthor, "author", "", "Author of the commits, as 'Name <email>' (default: your git config's identity)")
+	planCmd.PersistentFlags().StringVar(&planFlagCommitter, "committer", "", "Committer of the commits, as 'Name <email>' (default: your git config's identity)")
+	planCmd.PersistentFlags().BoolVarP(&planFlagSignoff, "signoff", "s", false, "Add a Signed-off-by trailer for the committer to the commits, for repos requiring a DCO")
+	planCmd.PersistentFlags().StringArrayVar(&planFlagCoAuthors, "co-author", nil, "Add a Co-authored-by trailer to the commits, as 'Name <email>'. Repeatable")
+	planCmd.PersistentFlags().StringArrayVar(&planFlagTrailers, "trailer", nil, "Add a trailer to the commits, e.g. 'Reviewed-by: Jane Doe <jane@example.com>'. Repeatable")
+	planCmd.PersistentFlags().StringVar(&planFlagSign, "sign", "", "Sign the commits with 'gpg' or 'ssh' (default: as your git config says)")
+	planCmd.PersistentFlags().StringVar(&planFlagSigningKey, "signing-key", "", "GPG key ID or SSH key file to sign the commits with (default: your git config's user.signingkey)")
+	planCmd.Flags().StringVar(&planFlagPatch, "patch", "", "Apply a patch instead of running a command: with 'git am' if made by 'git format-patch', else with 'git apply'. Conflicts and rejected hunks are kept in the plan dir")
+	planCmd.Flags().StringVar(&planFlagStarlark, "starlark", "", "Run a Starlark script instead of a command. Scripts can only read and write the repo's files, so they behave the same in every repo and on every machine")
 }
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"log"
+	"strings"
+
+	"github.com/Clever/microplane/plan"
+	"github.com/spf13/cobra"
+)
+
+var planEditFlagFiles []string
+var planEditFlagSet []string
+var planEditFlagAppend []string
+var planEditFlagDelete []string
+
+var planEditCmd = &cobra.Command{
+	Use:   "edit",
+	Args:  cobra.ExactArgs(0),
+	Short: "Plan changes by editing values in YAML, JSON and TOML files",
+	Long: `Plan changes by editing values in YAML, JSON and TOML files.
+
+Paths are dot-separated keys, with [n] to index into lists, e.g. 'spec.containers[0].image'.
+Values are parsed as YAML, so 'port=8080' sets a number, 'port="8080"' a string and 'tags=[a, b]' a list.
+
+Edits are made in the order --set, --append, --delete. Only the edited values are rewritten:
+comments, blank lines, key order and formatting elsewhere in the file are kept.
+Values written to JSON are converted to JSON, e.g. 0x10 becomes 16, and .inf or .nan fail.
+In TOML files, keys in inline tables ('a = { b = 1 }') and arrays of tables ('[[a]]') can't be edited.
+The plan fails if a path isn't found in one of the files: --set may only add a key to an existing table or mapping.`,
+	Example: `mp plan edit -b new-team -m 'Update team' --files 'launch/*.yml' --set team=eng-apps
+mp plan edit -b node-20 -m 'Use node 20' --files package.json --set engines.node='>=20' --delete engines.npm
+mp plan edit -b lint -m 'Enable linter' --files pyproject.toml --append tool.ruff.select=I`,
+	Run: func(cmd *cobra.Command, args []string) {
+		files, err := cmd.Flags().GetStringSlice("files")
+		if err != nil {
+			log.Fatal(err)
+		}
+		actions := []plan.EditAction{}
+		for _, flag := range []struct{ name, op string }{{"set", plan.EditSet}, {"append", plan.EditAppend}, {"delete", plan.EditDelete}} {
+			values, err := cmd.Flags().GetStringArray(flag.name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, v := range values {
+				action := plan.EditAction{Op: flag.op, Path: v}
+				if flag.op != plan.EditDelete {
+					kv := strings.SplitN(v, "=", 2)
+					if len(kv) != 2 {
+						log.Fatalf("invalid --%s '%s', expected 'path=value'", flag.name, v)
+					}
+					action.Path, action.Value = kv[0], kv[1]
+				}
+				actions = append(actions, action)
+			}
+		}
+
+		changeOperation, err = plan.NewEdit(files, actions)
+		if err != nil {
+			log.Fatalf("invalid edit: %s", err)
+		}
+		runPlan(cmd)
+	},
+}
+
+func init() {
+	planEditCmd.Flags().StringSliceVar(&planEditFlagFiles, "files", nil, "Glob patterns of the files to edit, relative to the repo root, e.g. '**/*.yml'")
+	planEditCmd.Flags().StringArrayVar(&planEditFlagSet, "set", nil, "Set a value, as 'path=value'")
+	planEditCmd.Flags().StringArrayVar(&planEditFlagAppend, "append", nil, "Append a value to a list, as 'path=value'")
+	planEditCmd.Flags().StringArrayVar(&planEditFlagDelete, "delete", nil, "Delete the value at a path")
+	planCmd.AddCommand(planEditCmd)
+}
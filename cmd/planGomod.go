@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/Clever/microplane/plan"
+	"github.com/spf13/cobra"
+)
+
+var planGomodFlagRequire []string
+var planGomodFlagTidy bool
+
+var planGomodCmd = &cobra.Command{
+	Use:   "gomod",
+	Args:  cobra.ExactArgs(0),
+	Short: "Plan changes by bumping Go module dependencies",
+	Long: `Plan changes by bumping Go module dependencies.
+
+Each --require is set in the go.mod at the root of the repo. Repos that don't depend on any of
+the modules, or already require the versions or newer, are skipped.
+The old and new versions are recorded in the plan's output, and listed in the PR body by mp push.`,
+	Example: `mp plan gomod -b bump-x-net -m 'Bump golang.org/x/net' --require golang.org/x/net@v0.47.0 --tidy`,
+	Run: func(cmd *cobra.Command, args []string) {
+		requires, err := cmd.Flags().GetStringArray("require")
+		if err != nil {
+			log.Fatal(err)
+		}
+		tidy, err := cmd.Flags().GetBool("tidy")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		changeOperation, err = plan.NewGoMod(requires, tidy)
+		if err != nil {
+			log.Fatalf("invalid gomod: %s", err)
+		}
+		runPlan(cmd)
+	},
+}
+
+func init() {
+	planGomodCmd.Flags().StringArrayVar(&planGomodFlagRequire, "require", nil, "Module to require, as 'module@version'")
+	planGomodCmd.Flags().BoolVar(&planGomodFlagTidy, "tidy", false, "Run 'go mod tidy' after editing go.mod")
+	planCmd.AddCommand(planGomodCmd)
+}
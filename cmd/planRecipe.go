@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"log"
+	"path"
+
+	"github.com/Clever/microplane/plan"
+	"github.com/spf13/cobra"
+)
+
+var planRecipeCmd = &cobra.Command{
+	Use:   "recipe [recipe.yml]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Plan changes by running the steps of a recipe",
+	Long: `Plan changes by running the steps of a recipe.
+
+A recipe is a YAML file listing steps to run in order. Each step is one of:
+
+  run: a shell command, or a list of arguments
+  replace: {files, pattern, replacement, multiline}, as in 'mp plan replace'
+  edit: {files, actions: [{op: set|append|delete, path, value}]}, as in 'mp plan edit'
+  gomod: {require: [module@version], tidy}, as in 'mp plan gomod'
+  starlark: a Starlark script to run, relative to this recipe, as in 'mp plan --starlark'
+  patch: a patch file to apply, relative to this recipe, as in 'mp plan --patch'
+  recipe: another recipe file to include, relative to this one
+
+A step with a 'message' commits its changes, so a recipe can make several commits.
+Remaining changes are committed with --message, or else the recipe's top-level 'message',
+or else the last step's message, which is then required.
+
+The recipe, with included recipes inlined, is saved in the workdir, along with copies of its
+Starlark scripts (and the modules they load) and patches. Without a recipe file, the saved recipe
+is planned again.`,
+	Example: `mp plan recipe -b upgrade-node upgrade-node.yml
+mp plan recipe -b upgrade-node`,
+	Run: func(cmd *cobra.Command, args []string) {
+		savedRecipePath := path.Join(workDir, "recipe.yml")
+		recipePath := savedRecipePath
+		if len(args) == 1 {
+			recipePath = args[0]
+		}
+		recipe, err := plan.LoadRecipe(recipePath)
+		if err != nil {
+			log.Fatalf("invalid recipe: %s", err)
+		}
+		if recipePath != savedRecipePath {
+			if err := recipe.Save(savedRecipePath); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		changeSteps, err = recipe.PlanSteps()
+		if err != nil {
+			log.Fatalf("invalid recipe: %s", err)
+		}
+		if !cmd.Flags().Changed("message") && recipe.Message != "" {
+			if err := cmd.Flags().Set("message", recipe.Message); err != nil {
+				log.Fatal(err)
+			}
+		}
+		runPlan(cmd)
+	},
+}
+
+func init() {
+	planCmd.AddCommand(planRecipeCmd)
+}
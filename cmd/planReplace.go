@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/Clever/microplane/plan"
+	"github.com/spf13/cobra"
+)
+
+var planReplaceFlagFiles []string
+var planReplaceFlagPattern string
+var planReplaceFlagReplacement string
+var planReplaceFlagMultiline bool
+
+var planReplaceCmd = &cobra.Command{
+	Use:   "replace",
+	Args:  cobra.ExactArgs(0),
+	Short: "Plan changes by replacing a regular expression in files",
+	Long: `Plan changes by replacing a regular expression in files.
+
+--pattern uses Go's regular expression syntax (https://golang.org/s/re2syntax), and is matched line by line
+unless --multiline is set. --replacement may refer to capture groups as $1 or ${name}.
+The number of replacements in each file is recorded in the plan's output.`,
+	Example: `mp plan replace -b bump-node -m 'Use node 20' --files '**/*.yml' --pattern 'node:\s*\d+' --replacement 'node: 20'
+mp plan replace -b rename -m 'Rename team' --files 'launch/*.yml' --pattern 'team: (\S+)-old' --replacement 'team: ${1}-new'`,
+	Run: func(cmd *cobra.Command, args []string) {
+		files, err := cmd.Flags().GetStringSlice("files")
+		if err != nil {
+			log.Fatal(err)
+		}
+		pattern, err := cmd.Flags().GetString("pattern")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if pattern == "" {
+			log.Fatal("--pattern is required")
+		}
+		replacement, err := cmd.Flags().GetString("replacement")
+		if err != nil {
+			log.Fatal(err)
+		}
+		multiline, err := cmd.Flags().GetBool("multiline")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		changeOperation, err = plan.NewReplace(files, pattern, replacement, multiline)
+		if err != nil {
+			log.Fatalf("invalid replace: %s", err)
+		}
+		runPlan(cmd)
+	},
+}
+
+func init() {
+	planReplaceCmd.Flags().StringSliceVar(&planReplaceFlagFiles, "files", nil, "Glob patterns of the files to replace in, relative to the repo root, e.g. '**/*.yml'")
+	planReplaceCmd.Flags().StringVar(&planReplaceFlagPattern, "pattern", "", "Regular expression to replace")
+	planReplaceCmd.Flags().StringVar(&planReplaceFlagReplacement, "replacement", "", "Replacement for each match, may refer to capture groups as $1 or ${name}")
+	planReplaceCmd.Flags().BoolVar(&planReplaceFlagMultiline, "multiline", false, "Match against whole files, so matches can span lines")
+	planCmd.AddCommand(planReplaceCmd)
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Clever/microplane/git"
+	"github.com/Clever/microplane/lib"
+	"github.com/Clever/microplane/plan"
+	"github.com/Clever/microplane/push"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// branchesGit is a git.Git listing fixed remote branches, and removing worktrees as plain directories
+type branchesGit struct {
+	git.Git
+	branches []string
+}
+
+func (g branchesGit) RemoteBranches(ctx context.Context, dir string) ([]string, error) {
+	return g.branches, nil
+}
+
+func (g branchesGit) RemoveWorktree(ctx context.Context, repoDir, dir string) error {
+	return os.RemoveAll(dir)
+}
+
+func TestPlanTargets(t *testing.T) {
+	ctx := context.Background()
+	gitClient = branchesGit{branches: []string{"main", "release/1.0", "release-1.0", "release/2.0"}}
+	branchName = "bump"
+	r := lib.Repo{Owner: "clever", Name: "app"}
+
+	names := func(targets []planTarget) [][3]string {
+		names := [][3]string{}
+		for _, target := range targets {
+			names = append(names, [3]string{target.repo.StateName(), target.baseBranch, target.branchName})
+		}
+		return names
+	}
+
+	baseBranchPattern = ""
+	targets, err := planTargets(ctx, r, "")
+	require.NoError(t, err)
+	assert.Equal(t, [][3]string{{"app", "", "bump"}}, names(targets))
+
+	// a pattern matching a single branch plans against it in the repo's own state
+	baseBranchPattern = "release/1*"
+	targets, err = planTargets(ctx, r, "")
+	require.NoError(t, err)
+	assert.Equal(t, [][3]string{{"app", "release/1.0", "bump"}}, names(targets))
+
+	// branches that only differ by "/" get their own state and branch
+	baseBranchPattern = `release[/\-]*`
+	targets, err = planTargets(ctx, r, "")
+	require.NoError(t, err)
+	assert.Equal(t, [][3]string{
+		{"app@release-1.0", "release-1.0", "bump-release-1.0"},
+		{"app@release%2F1.0", "release/1.0", "bump-release%2F1.0"},
+		{"app@release%2F2.0", "release/2.0", "bump-release%2F2.0"},
+	}, names(targets))
+
+	baseBranchPattern = "release/["
+	_, err = planTargets(ctx, r, "")
+	assert.Error(t, err)
+}
+
+func TestClearStaleTargets(t *testing.T) {
+	ctx := context.Background()
+	gitClient = branchesGit{}
+	workDir = t.TempDir()
+	r := lib.Repo{Owner: "clever", Name: "app"}
+	writeState := func(stateName, step string, output interface{}) {
+		require.NoError(t, os.MkdirAll(filepath.Join(filepath.Dir(outputPath(stateName, step)), "planned"), 0755))
+		require.NoError(t, writeJSON(output, outputPath(stateName, step)))
+	}
+	target := func(base string) planTarget {
+		target := r
+		target.BaseBranch = base
+		return planTarget{repo: target, baseBranch: base}
+	}
+
+	// planned against the default branch, then against release/1.0 and release/2.0
+	writeState("app", "plan", plan.Output{Success: true})
+	writeState("app@release%2F1.0", "plan", plan.Output{Success: true, BaseBranch: "release/1.0"})
+	writeState("app@release%2F2.0", "plan", plan.Output{Success: true, BaseBranch: "release/2.0"})
+
+	// planning against release/1.0 only removes the others' state, but not the clone
+	require.NoError(t, os.MkdirAll(filepath.Dir(outputPath("app", "clone")), 0755))
+	require.NoError(t, clearStaleTargets(ctx, r, "", []planTarget{target("release/1.0"), target("release/3.0")}))
+	assert.NoDirExists(t, filepath.Dir(outputPath("app", "plan")))
+	assert.DirExists(t, filepath.Dir(outputPath("app", "clone")))
+	assert.FileExists(t, outputPath("app@release%2F1.0", "plan"))
+	assert.NoDirExists(t, filepath.Join(workDir, "app@release%2F2.0"))
+
+	// pushed targets are never removed
+	writeState("app@release%2F1.0", "push", push.Output{Success: true})
+	err := clearStaleTargets(ctx, r, "", []planTarget{{repo: r}})
+	assert.ErrorContains(t, err, "previously planned and pushed app@release%2F1.0")
+	assert.FileExists(t, outputPath("app@release%2F1.0", "plan"))
+}
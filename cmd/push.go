@@ -2,16 +2,19 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/Clever/microplane/lib"
 	"github.com/Clever/microplane/merge"
 	"github.com/Clever/microplane/plan"
 	"github.com/Clever/microplane/push"
+	"github.com/Clever/microplane/review"
 	"github.com/spf13/cobra"
 )
 
@@ -21,6 +24,8 @@ var pushFlagThrottle string
 var pushFlagBodyFile string
 var pushFlagLabels []string
 var pushFlagDraft bool
+var pushFlagForce bool
+var pushFlagRequireReview bool
 
 // rate limits the # of git pushes. used to prevent load on CI system
 var pushThrottle *time.Ticker
@@ -29,6 +34,8 @@ var prAssignee string
 var prBody string
 var prLabels []string
 var prDraft bool
+var pushForce bool
+var pushRequireReview bool
 
 var pushCmd = &cobra.Command{
 	Use:   "push",
@@ -55,6 +62,9 @@ var pushCmd = &cobra.Command{
 			}
 			prBody = string(prBodyBytes)
 		}
+		if err := plan.CheckTemplate("body", prBody); err != nil {
+			log.Fatalf("invalid --body-file template: %s", err)
+		}
 
 		throttle, err := cmd.Flags().GetString("throttle")
 		if err != nil {
@@ -83,10 +93,24 @@ var pushCmd = &cobra.Command{
 		}
 		prDraft = draft
 
+		pushForce, err = cmd.Flags().GetBool("force")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		pushRequireReview, err = cmd.Flags().GetBool("require-review")
+		if err != nil {
+			log.Fatal(err)
+		}
+
 		repos, err := whichRepos(cmd)
 		if err != nil {
 			log.Fatal(err)
 		}
+		repos, err = expandBaseBranches(repos)
+		if err != nil {
+			log.Fatal(err)
+		}
 
 		err = parallelize(repos, pushOneRepo)
 		if err != nil {
@@ -102,27 +126,48 @@ var pushCmd = &cobra.Command{
 }
 
 func pushOneRepo(r lib.Repo, ctx context.Context) error {
-	log.Printf("pushing: %s/%s", r.Owner, r.Name)
+	log.Printf("pushing: %s/%s", r.Owner, r.StateName())
 
 	// Exit early if already merged
 	var mergeOutput struct {
 		merge.Output
 		Error string
 	}
-	if loadJSON(outputPath(r.Name, "merge"), &mergeOutput) == nil && mergeOutput.Success {
-		log.Printf("%s/%s - already merged", r.Owner, r.Name)
+	if loadJSON(outputPath(r.StateName(), "merge"), &mergeOutput) == nil && mergeOutput.Success {
+		log.Printf("%s/%s - already merged", r.Owner, r.StateName())
 		return nil
 	}
 
 	// Get previous step's output
 	var planOutput plan.Output
-	if loadJSON(outputPath(r.Name, "plan"), &planOutput) != nil || !planOutput.Success {
-		log.Printf("skipping %s/%s, must successfully plan first", r.Owner, r.Name)
+	if loadJSON(outputPath(r.StateName(), "plan"), &planOutput) != nil || !planOutput.Success {
+		if planOutput.NoOp {
+			log.Printf("skipping %s/%s, plan made no changes", r.Owner, r.StateName())
+		} else {
+			log.Printf("skipping %s/%s, must successfully plan first", r.Owner, r.StateName())
+		}
 		return nil
 	}
+	if failed := planOutput.FailedValidations(); len(failed) > 0 && !pushForce {
+		log.Printf("skipping %s/%s, failed validation: %s. Use --force to push anyway", r.Owner, r.StateName(), strings.Join(failed, ", "))
+		return nil
+	}
+	switch decision := reviewDecision(r, planOutput); {
+	case decision == review.Rejected:
+		log.Printf("skipping %s/%s, rejected in review", r.Owner, r.StateName())
+		return nil
+	case decision != review.Approved && pushRequireReview:
+		log.Printf("skipping %s/%s, not approved in review", r.Owner, r.StateName())
+		return nil
+	}
+
+	body, err := pullRequestBody(planOutput)
+	if err != nil {
+		return fmt.Errorf("%s/%s error: rendering PR body: %w", r.Owner, r.StateName(), err)
+	}
 
 	// Prepare workdir for current step's output
-	pushOutputPath := outputPath(r.Name, "push")
+	pushOutputPath := outputPath(r.StateName(), "push")
 	pushWorkDir := filepath.Dir(pushOutputPath)
 	if err := os.MkdirAll(pushWorkDir, 0755); err != nil {
 		return err
@@ -134,14 +179,15 @@ func pushOneRepo(r lib.Repo, ctx context.Context) error {
 		PlanDir:       planOutput.PlanDir,
 		WorkDir:       pushWorkDir,
 		CommitMessage: planOutput.CommitMessage,
-		PRBody:        prBody,
+		PRBody:        body,
 		PRAssignee:    prAssignee,
 		BranchName:    planOutput.BranchName,
+		BaseBranch:    planOutput.BaseBranch,
 		Labels:        prLabels,
 		Draft:         prDraft,
+		Git:           gitClient,
 	}
 	var output push.Output
-	var err error
 	if r.IsGitlab() {
 		output, err = push.GitlabPush(ctx, input, repoLimiter, pushThrottle)
 	} else if r.IsGithub() {
@@ -159,10 +205,28 @@ func pushOneRepo(r lib.Repo, ctx context.Context) error {
 	return nil
 }
 
+// pullRequestBody renders the PR body template for the repo, adding the dependency changes made by `mp plan gomod`
+func pullRequestBody(planOutput plan.Output) (string, error) {
+	body, err := plan.RenderTemplate("body", prBody, planOutput.Template)
+	if err != nil {
+		return "", err
+	}
+	if len(planOutput.GoModChanges) == 0 {
+		return body, nil
+	}
+	lines := []string{"| Module | From | To |", "| --- | --- | --- |"}
+	for _, c := range planOutput.GoModChanges {
+		lines = append(lines, fmt.Sprintf("| `%s` | %s | %s |", c.Module, c.OldVersion, c.NewVersion))
+	}
+	return strings.TrimSpace(body + "\n\n" + strings.Join(lines, "\n")), nil
+}
+
 func init() {
 	pushCmd.Flags().StringVarP(&pushFlagThrottle, "throttle", "t", "30s", "Throttle number of pushes, e.g. '30s' means 1 push per 30 seconds")
 	pushCmd.Flags().StringVarP(&pushFlagAssignee, "assignee", "a", "", "Github user to assign the PR to")
-	pushCmd.Flags().StringVarP(&pushFlagBodyFile, "body-file", "b", "", "body of PR")
+	pushCmd.Flags().StringVarP(&pushFlagBodyFile, "body-file", "b", "", "body of PR. A Go template, e.g. 'Bumps foo to {{.Values.version}} in {{.Repo}}'")
 	pushCmd.Flags().StringSliceVarP(&pushFlagLabels, "labels", "l", nil, "labels to attach to PR. for example: `-l 'first label' -l 'second label'`")
 	pushCmd.Flags().BoolVarP(&pushFlagDraft, "draft", "d", false, "push a draft pull request (only supported for github)")
+	pushCmd.Flags().BoolVar(&pushFlagForce, "force", false, "push repos whose change failed validation in plan")
+	pushCmd.Flags().BoolVar(&pushFlagRequireReview, "require-review", false, "only push repos approved with 'mp review'")
 }
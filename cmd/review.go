@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/Clever/microplane/lib"
+	"github.com/Clever/microplane/plan"
+	"github.com/Clever/microplane/push"
+	"github.com/Clever/microplane/review"
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+)
+
+var reviewFlagAll bool
+var reviewFlagNoPager bool
+
+var reviewCmd = &cobra.Command{
+	Use:   "review",
+	Short: "Review planned changes one repo at a time",
+	Long: `Review planned changes one repo at a time.
+
+The diff of each planned repo is shown in $PAGER (default: 'less -FRX'), then the repo can be
+approved, rejected or skipped. Rejected repos are never pushed, and 'mp push --require-review' only
+pushes approved repos. Decisions are kept until the repo's diff changes, e.g. by planning again.`,
+	Args: cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		all, err := cmd.Flags().GetBool("all")
+		if err != nil {
+			log.Fatal(err)
+		}
+		noPager, err := cmd.Flags().GetBool("no-pager")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		repos, err := whichRepos(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		repos, err = expandBaseBranches(repos)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		toReview := []lib.Repo{}
+		for _, r := range repos {
+			var planOutput plan.Output
+			if loadJSON(outputPath(r.StateName(), "plan"), &planOutput) != nil || !planOutput.Success {
+				continue
+			}
+			var pushOutput push.Output
+			if loadJSON(outputPath(r.StateName(), "push"), &pushOutput) == nil && pushOutput.Success {
+				continue
+			}
+			if !all && reviewDecision(r, planOutput) != "" {
+				continue
+			}
+			toReview = append(toReview, r)
+		}
+		if len(toReview) == 0 {
+			log.Printf("no planned repos to review")
+			return
+		}
+
+		stdin := bufio.NewReader(os.Stdin)
+		for i, r := range toReview {
+			quit, err := reviewOneRepo(r, fmt.Sprintf("%d/%d", i+1, len(toReview)), stdin, !noPager)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if quit {
+				return
+			}
+		}
+	},
+}
+
+// reviewOneRepo shows a repo's diff and records the decision made on it. It returns whether to stop reviewing.
+func reviewOneRepo(r lib.Repo, progress string, stdin *bufio.Reader, usePager bool) (bool, error) {
+	var planOutput plan.Output
+	if err := loadJSON(outputPath(r.StateName(), "plan"), &planOutput); err != nil {
+		return false, err
+	}
+	header := fmt.Sprintf("[%s] %s/%s\n%s\n\n", progress, r.Owner, r.StateName(), planOutput.CommitMessage)
+	if err := pageDiff(header, planOutput, usePager); err != nil {
+		return false, err
+	}
+
+	for {
+		fmt.Printf("%s %s/%s - [a]pprove, [r]eject, [s]kip, [v]iew again, [q]uit? ", progress, r.Owner, r.StateName())
+		answer, err := stdin.ReadString('\n')
+		if err == io.EOF {
+			fmt.Println()
+			return true, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		decision := ""
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "a", "approve":
+			decision = review.Approved
+		case "r", "reject":
+			decision = review.Rejected
+		case "s", "skip":
+			return false, nil
+		case "v", "view":
+			if err := pageDiff(header, planOutput, usePager); err != nil {
+				return false, err
+			}
+			continue
+		case "q", "quit":
+			return true, nil
+		default:
+			continue
+		}
+
+		return false, writeReview(r, decision, planOutput.DiffSHA)
+	}
+}
+
+// pageDiff streams the header and the repo's planned diff through the pager, when stdout is a terminal
+func pageDiff(header string, planOutput plan.Output, usePager bool) error {
+	if !usePager || !isatty.IsTerminal(os.Stdout.Fd()) {
+		fmt.Print(header)
+		if err := copyDiff(os.Stdout, planOutput, true); err != nil {
+			return err
+		}
+		fmt.Println()
+		return nil
+	}
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less -FRX"
+	}
+	pagerCmd := exec.Command("sh", "-c", pager)
+	pagerCmd.Stdout = os.Stdout
+	pagerCmd.Stderr = os.Stderr
+	stdin, err := pagerCmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := pagerCmd.Start(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(stdin, header)
+	if err == nil {
+		err = copyDiff(stdin, planOutput, true)
+	}
+	stdin.Close()
+	if waitErr := pagerCmd.Wait(); waitErr != nil {
+		return waitErr
+	}
+	// the pager may be quit before it read the whole diff
+	if err != nil && !errors.Is(err, syscall.EPIPE) {
+		return err
+	}
+	return nil
+}
+
+// reviewDecision returns the decision made with `mp review` on the repo's current plan, if any
+func reviewDecision(r lib.Repo, planOutput plan.Output) string {
+	var reviewOutput review.Output
+	if loadJSON(outputPath(r.StateName(), "review"), &reviewOutput) != nil {
+		return ""
+	}
+	return reviewOutput.DecisionFor(planOutput.DiffSHA)
+}
+
+// reviewStatus describes a repo's review decision for `mp status`
+func reviewStatus(r lib.Repo, planOutput plan.Output) string {
+	switch reviewDecision(r, planOutput) {
+	case review.Approved:
+		return color.GreenString(" (approved)")
+	case review.Rejected:
+		return color.RedString(" (rejected)")
+	}
+	return ""
+}
+
+func init() {
+	reviewCmd.Flags().BoolVar(&reviewFlagAll, "all", false, "Also review repos already approved or rejected")
+	reviewCmd.Flags().BoolVar(&reviewFlagNoPager, "no-pager", false, "Print diffs instead of showing them in $PAGER")
+}
@@ -6,8 +6,10 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/Clever/microplane/git"
 	"github.com/Clever/microplane/initialize"
 	"github.com/spf13/cobra"
 )
@@ -16,6 +18,9 @@ var workDir string
 var cliVersion string
 var defaultParallelism int64 = 10
 
+// gitClient runs git operations, as selected by the `git-backend` flag
+var gitClient git.Git
+
 // Github's rate limit for authenticated requests is 5000 QPH = 83.3 QPM = 1.38 QPS = 720ms/query
 // We also use a global limiter to prevent concurrent requests, which trigger Github's abuse detection
 var repoLimiter = time.NewTicker(720 * time.Millisecond)
@@ -23,18 +28,33 @@ var repoLimiter = time.NewTicker(720 * time.Millisecond)
 var rootCmd = &cobra.Command{
 	Use:   "mp",
 	Short: "Microplane makes git changes across many repos",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		gitClient, err = gitBackend(cmd)
+		return err
+	},
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringP("repo", "r", "", "single repo to operate on")
+	rootCmd.PersistentFlags().StringArrayP("repo", "r", nil, "repo to operate on, by name, owner/name or glob pattern such as 'app-*'. Repeatable")
+	rootCmd.PersistentFlags().String("from-file", "", "file listing repos to operate on, one name or pattern per line")
+	rootCmd.PersistentFlags().StringArray("exclude", nil, "repo not to operate on, by name, owner/name or glob pattern. Repeatable")
+	rootCmd.PersistentFlags().Bool("only-failed", false, "only operate on repos whose last step failed")
+	rootCmd.PersistentFlags().String("only-status", "", fmt.Sprintf("only operate on repos with this status, as shown by 'mp status': %s", strings.Join(repoStatuses, ", ")))
+	rootCmd.PersistentFlags().String("git-backend", git.BackendAuto, fmt.Sprintf("how to run git: '%s' (the git binary), '%s' (in-process), or '%s' (git binary if installed, otherwise go-git)", git.BackendExec, git.BackendGoGit, git.BackendAuto))
+	rootCmd.AddCommand(backportCmd)
 	rootCmd.AddCommand(cloneCmd)
+	rootCmd.AddCommand(diffCmd)
 	rootCmd.AddCommand(docsCmd)
+	rootCmd.AddCommand(exportPatchesCmd)
 	rootCmd.AddCommand(mergeCmd)
 	rootCmd.AddCommand(planCmd)
 	rootCmd.AddCommand(pushCmd)
+	rootCmd.AddCommand(reviewCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(syncCmd)
 	rootCmd.AddCommand(initCmd)
+	rootCmd.AddCommand(logsCmd)
 	rootCmd.AddCommand(versionCmd)
 
 	var err error
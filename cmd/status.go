@@ -2,11 +2,15 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"text/tabwriter"
 
+	"github.com/Clever/microplane/backport"
 	"github.com/Clever/microplane/clone"
 	"github.com/Clever/microplane/initialize"
 	"github.com/Clever/microplane/lib"
@@ -15,7 +19,6 @@ import (
 	"github.com/Clever/microplane/push"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
-	"github.com/waigani/diffparser"
 )
 
 var statusCmd = &cobra.Command{
@@ -38,6 +41,10 @@ var statusCmd = &cobra.Command{
 		if err != nil {
 			log.Fatal(err)
 		}
+		repos, err = expandBaseBranches(repos)
+		if err != nil {
+			log.Fatal(err)
+		}
 		sync, err := cmd.Flags().GetBool("sync")
 		if err != nil {
 			log.Fatal(err)
@@ -50,7 +57,11 @@ var statusCmd = &cobra.Command{
 			}
 		}
 
-		printStatus(repos)
+		files, err := cmd.Flags().GetBool("files")
+		if err != nil {
+			log.Fatal(err)
+		}
+		printStatus(repos, files)
 	},
 }
 
@@ -69,22 +80,95 @@ func joinWithTab(s ...string) string {
 	return strings.Join(s, "\t")
 }
 
-func printStatus(repos []lib.Repo) {
+func printStatus(repos []lib.Repo, files bool) {
 	out := tabWriterWithDefaults()
 	fmt.Fprintln(out, joinWithTab("REPO", "STATUS", "DETAILS"))
+	planned := []repoDiffStat{}
 	for _, r := range repos {
-		status, details := getRepoStatus(r)
+		planOutput, loaded := loadPlanResult(r)
+		status, details := repoStatus(r, planOutput, loaded)
 		d2 := strings.TrimSpace(details)
 		d3 := strings.Join(strings.Split(d2, "\n"), " ")
 		if len(d3) > 150 {
 			d3 = d3[:150] + "..."
 		}
-		fmt.Fprintln(out, joinWithTab(r.Name, status, d3))
+		fmt.Fprintln(out, joinWithTab(r.StateName(), status, d3))
+		stat, ok := planDiffStat(planOutput.Output)
+		if !ok {
+			continue
+		}
+		planned = append(planned, repoDiffStat{r.StateName(), stat})
+		if files {
+			for _, f := range stat.Files {
+				fmt.Fprintln(out, joinWithTab("", "", "  "+f.String()))
+			}
+		}
 	}
 	out.Flush()
+	printCampaignStats(os.Stdout, planned)
+}
+
+// repoDiffStat is the DiffStat of a repo's planned change
+type repoDiffStat struct {
+	name string
+	stat plan.DiffStat
+}
+
+// largestDiffs is how many of the largest diffs to list in the campaign's stats
+const largestDiffs = 3
+
+// printCampaignStats sums up the changes planned across repos, and lists the largest
+func printCampaignStats(w io.Writer, planned []repoDiffStat) {
+	if len(planned) < 2 {
+		return
+	}
+	total := plan.DiffStat{}
+	for _, p := range planned {
+		total.Files = append(total.Files, p.stat.Files...)
+		total.Insertions += p.stat.Insertions
+		total.Deletions += p.stat.Deletions
+	}
+	fmt.Fprintf(w, "\n%d repos planned: %s\n", len(planned), total)
+
+	sort.SliceStable(planned, func(i, j int) bool { return planned[i].stat.Size() > planned[j].stat.Size() })
+	largest := []string{}
+	for _, p := range planned[:min(largestDiffs, len(planned))] {
+		largest = append(largest, fmt.Sprintf("%s (+%d -%d)", p.name, p.stat.Insertions, p.stat.Deletions))
+	}
+	fmt.Fprintf(w, "largest diffs: %s\n", strings.Join(largest, ", "))
+}
+
+// planDiffStat is the DiffStat of a successful plan, if it is one
+func planDiffStat(planOutput plan.Output) (plan.DiffStat, bool) {
+	if !planOutput.Success {
+		return plan.DiffStat{}, false
+	}
+	if planOutput.DiffPath == "" && planOutput.GitDiff != "" {
+		return plan.ParseDiffStat(planOutput.GitDiff), true
+	}
+	return planOutput.DiffStat, true
+}
+
+// planResult is a repo's plan output, with the error of a failed plan
+type planResult struct {
+	plan.Output
+	Error string
+}
+
+// loadPlanResult loads a repo's plan output, and whether it has one
+func loadPlanResult(repo lib.Repo) (planResult, bool) {
+	var planOutput planResult
+	err := loadJSON(outputPath(repo.StateName(), "plan"), &planOutput)
+	return planOutput, err == nil
 }
 
 func getRepoStatus(repo lib.Repo) (status, details string) {
+	planOutput, loaded := loadPlanResult(repo)
+	return repoStatus(repo, planOutput, loaded)
+}
+
+// repoStatus is the status of a repo, given its plan output, which is loaded only once for all status shows about it
+func repoStatus(repo lib.Repo, planOutput planResult, planLoaded bool) (status, details string) {
 	repoName := repo.Name
 	status = "initialized"
 	details = ""
@@ -100,30 +184,39 @@ func getRepoStatus(repo lib.Repo) (status, details string) {
 	}
 	status = "cloned"
 
-	var planOutput struct {
-		plan.Output
-		Error string
-	}
-	if !(loadJSON(outputPath(repoName, "plan"), &planOutput) == nil && planOutput.Success) {
-		if planOutput.Error != "" {
+	if !(planLoaded && planOutput.Success) {
+		if planOutput.NoOp {
+			status = "no-op"
+			details = "plan made no changes"
+		} else if planOutput.SkipReason != "" {
+			details = color.YellowString("(plan skipped) ") + planOutput.SkipReason
+		} else if planOutput.PatchResult == plan.PatchConflict || planOutput.PatchResult == plan.PatchRejected {
+			details = color.RedString("(patch %s) ", planOutput.PatchResult) + strings.Join(planOutput.PatchFiles, ", ")
+		} else if planOutput.KilledReason != "" {
+			details = color.RedString("(plan killed) ") + planOutput.KilledReason
+		} else if planOutput.Error != "" {
 			details = color.RedString("(plan error) ") + planOutput.Error
 		}
 		return
 	}
 	status = "planned"
-	diff, err := diffparser.Parse(planOutput.GitDiff)
-	if err == nil {
-		details = fmt.Sprintf("%d file(s) modified", len(diff.Files))
+	if stat, ok := planDiffStat(planOutput.Output); ok {
+		details = stat.String()
+	}
+	if failed := planOutput.FailedValidations(); len(failed) > 0 {
+		details = color.RedString("(validation failed) ") + strings.Join(failed, ", ")
 	}
+	details += reviewStatus(repo, planOutput.Output)
 	if isSingleRepo {
-		fmt.Println(planOutput.GitDiff)
+		copyDiff(os.Stdout, planOutput.Output, false)
+		fmt.Println()
 	}
 
 	var pushOutput struct {
 		push.Output
 		Error string
 	}
-	if !(loadJSON(outputPath(repoName, "push"), &pushOutput) == nil && pushOutput.Success) {
+	if !(loadJSON(outputPath(repo.StateName(), "push"), &pushOutput) == nil && pushOutput.Success) {
 		if pushOutput.Error != "" {
 			details = color.RedString("(push error) ") + pushOutput.Error
 		}
@@ -137,18 +230,51 @@ func getRepoStatus(repo lib.Repo) (status, details string) {
 		Error string
 	}
 	// check PR was merged
-	if !(loadJSON(outputPath(repoName, "merge"), &mergeOutput) == nil && mergeOutput.Success) {
+	if !(loadJSON(outputPath(repo.StateName(), "merge"), &mergeOutput) == nil && mergeOutput.Success) {
 		if mergeOutput.Error != "" {
 			details = color.RedString("(merge error) ") + mergeOutput.Error
 		}
 		return
 	}
 	status = "merged"
-	details = ""
+	details = backportDetails(repo, mergeOutput.MergeCommitSHA)
 
 	return
 }
 
+// backportDetails summarizes the backports of a repo's merge commit. A repo planned against several base branches
+// is backported from only one of them.
+func backportDetails(repo lib.Repo, mergeCommitSHA string) string {
+	paths, err := filepath.Glob(backportOutputPath(repo.Name, "*"))
+	if err != nil || len(paths) == 0 {
+		return ""
+	}
+	backported, failed := []string{}, []string{}
+	for _, p := range paths {
+		var backportOutput struct {
+			backport.Output
+			Error string
+		}
+		if loadJSON(p, &backportOutput) != nil || backportOutput.CommitSHA != mergeCommitSHA {
+			continue
+		}
+		if backportOutput.Success {
+			backported = append(backported, backportOutput.BaseBranch)
+		} else {
+			failed = append(failed, backportOutput.BaseBranch)
+		}
+	}
+	details := []string{}
+	if len(backported) > 0 {
+		details = append(details, "backported to: "+strings.Join(backported, ", "))
+	}
+	if len(failed) > 0 {
+		details = append(details, color.RedString("(backport error) ")+strings.Join(failed, ", "))
+	}
+	return strings.Join(details, " ")
+}
+
 func init() {
 	statusCmd.Flags().BoolP("sync", "s", false, "Sync workflow status with repo origin")
+	statusCmd.Flags().Bool("files", false, "List the files changed by each repo's plan, with their insertions and deletions")
 }
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Clever/microplane/plan"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintCampaignStats(t *testing.T) {
+	stat := func(files, insertions, deletions int) plan.DiffStat {
+		s := plan.DiffStat{Insertions: insertions, Deletions: deletions}
+		for i := 0; i < files; i++ {
+			s.Files = append(s.Files, plan.FileStat{Path: "f"})
+		}
+		return s
+	}
+	var out bytes.Buffer
+	printCampaignStats(&out, []repoDiffStat{
+		{"small", stat(1, 1, 0)},
+		{"large", stat(3, 40, 2)},
+		{"medium", stat(2, 5, 5)},
+		{"tiny", stat(1, 0, 1)},
+	})
+	assert.Equal(t, "\n4 repos planned: 7 file(s) changed, +46 -8\n"+
+		"largest diffs: large (+40 -2), medium (+5 -5), small (+1 -0)\n", out.String())
+
+	out.Reset()
+	printCampaignStats(&out, []repoDiffStat{{"only", stat(1, 1, 0)}})
+	assert.Empty(t, out.String())
+}
@@ -34,6 +34,10 @@ var syncCmd = &cobra.Command{
 		if err != nil {
 			log.Fatal(err)
 		}
+		repos, err = expandBaseBranches(repos)
+		if err != nil {
+			log.Fatal(err)
+		}
 
 		err = parallelize(repos, syncOneRepo)
 		if err != nil {
@@ -44,15 +48,14 @@ var syncCmd = &cobra.Command{
 }
 
 func syncOneRepo(r lib.Repo, ctx context.Context) error {
-	log.Printf("syncing: %s/%s", r.Owner, r.Name)
-	repoName := r.Name
+	log.Printf("syncing: %s/%s", r.Owner, r.StateName())
 
 	var pushOutput struct {
 		push.Output
 		Error string
 	}
 
-	if !(loadJSON(outputPath(repoName, "push"), &pushOutput) == nil && pushOutput.Success) {
+	if !(loadJSON(outputPath(r.StateName(), "push"), &pushOutput) == nil && pushOutput.Success) {
 		return nil
 	}
 	output, err := syncPush(r, ctx, pushOutput.Output)
@@ -65,7 +68,7 @@ func syncOneRepo(r lib.Repo, ctx context.Context) error {
 		Error string
 	}
 
-	if loadJSON(outputPath(repoName, "merge"), &mergeOutput) == nil && mergeOutput.Success {
+	if loadJSON(outputPath(r.StateName(), "merge"), &mergeOutput) == nil && mergeOutput.Success {
 		return nil
 	}
 
@@ -73,7 +76,7 @@ func syncOneRepo(r lib.Repo, ctx context.Context) error {
 		return err
 	}
 
-	log.Printf("synced: %s/%s", r.Owner, r.Name)
+	log.Printf("synced: %s/%s", r.Owner, r.StateName())
 	return nil
 }
 
@@ -92,7 +95,7 @@ func syncPush(r lib.Repo, ctx context.Context, pushOutput push.Output) (sync.Out
 	pushOutput.CommitSHA = output.CommitSHA
 	pushOutput.PullRequestCombinedStatus = output.PullRequestCombinedStatus
 
-	writeJSON(pushOutput, outputPath(r.Name, "push"))
+	writeJSON(pushOutput, outputPath(r.StateName(), "push"))
 	return output, nil
 }
 func syncMerge(r lib.Repo, ctx context.Context, output sync.Output) error {
@@ -100,7 +103,7 @@ func syncMerge(r lib.Repo, ctx context.Context, output sync.Output) error {
 		return nil
 	}
 
-	mergeOutputPath := outputPath(r.Name, "merge")
+	mergeOutputPath := outputPath(r.StateName(), "merge")
 	mergeWorkDir := filepath.Dir(mergeOutputPath)
 	if err := os.MkdirAll(mergeWorkDir, 0755); err != nil {
 		return err
@@ -0,0 +1,230 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Exec implements Git by shelling out to the git binary.
+type Exec struct{}
+
+// run executes `git args...` in dir and returns its combined output.
+func (g Exec) run(ctx context.Context, op, dir string, args ...string) (string, error) {
+	return g.runEnv(ctx, op, dir, nil, args...)
+}
+
+// runEnv executes `git args...` in dir with env added to the environment, and returns its combined output.
+func (Exec) runEnv(ctx context.Context, op, dir string, env []string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(output), &Error{Op: op, Dir: dir, Output: string(output), Err: classify(string(output), err)}
+	}
+	return string(output), nil
+}
+
+// repositoryNotFound matches git's "repository '<url>' not found" and "repository '<path>' does not exist",
+// but not the "does not exist" of missing refs or paths
+var repositoryNotFound = regexp.MustCompile(`repository '[^']*' (not found|does not exist)`)
+
+// classify maps well-known git failure messages to our typed errors.
+func classify(output string, err error) error {
+	switch {
+	case strings.Contains(output, "nothing to commit"), strings.Contains(output, "nothing added to commit"):
+		return ErrNothingToCommit
+	case strings.Contains(output, "Authentication failed"),
+		strings.Contains(output, "Permission denied (publickey)"),
+		strings.Contains(output, "could not read Username"):
+		return ErrAuthentication
+	case strings.Contains(output, "Repository not found"),
+		strings.Contains(output, "does not appear to be a git repository"),
+		repositoryNotFound.MatchString(output):
+		return ErrRepositoryNotFound
+	}
+	return err
+}
+
+func (g Exec) Clone(ctx context.Context, url, dir string) error {
+	_, err := g.run(ctx, "clone", filepath.Dir(dir), "clone", url, dir)
+	return err
+}
+
+func (g Exec) CheckoutBranch(ctx context.Context, dir, branch string) error {
+	_, err := g.run(ctx, "checkout", dir, "checkout", "-B", branch)
+	return err
+}
+
+func (g Exec) AddAll(ctx context.Context, dir string) error {
+	_, err := g.run(ctx, "add", dir, "add", "-A")
+	return err
+}
+
+func (g Exec) Commit(ctx context.Context, dir, message string, opts CommitOptions) error {
+	args := []string{}
+	switch opts.Signing.Format {
+	case "":
+	case SignGPG, SignSSH:
+		args = append(args, "-c", "gpg.format="+gpgFormat(opts.Signing.Format))
+	default:
+		return &Error{Op: "commit", Dir: dir, Err: fmt.Errorf("unknown signature format '%s'", opts.Signing.Format)}
+	}
+	args = append(args, "commit", "-m", message)
+	if opts.AllowEmpty {
+		args = append(args, "--allow-empty")
+	}
+	if opts.Signoff {
+		args = append(args, "--signoff")
+	}
+	if opts.Signing.Format != "" {
+		args = append(args, "--gpg-sign="+opts.Signing.Key)
+	}
+	// the environment takes precedence over the git config's identity
+	env := []string{}
+	if !opts.Author.IsZero() {
+		env = append(env, "GIT_AUTHOR_NAME="+opts.Author.Name, "GIT_AUTHOR_EMAIL="+opts.Author.Email)
+	}
+	if !opts.Committer.IsZero() {
+		env = append(env, "GIT_COMMITTER_NAME="+opts.Committer.Name, "GIT_COMMITTER_EMAIL="+opts.Committer.Email)
+	}
+	_, err := g.runEnv(ctx, "commit", dir, env, args...)
+	return err
+}
+
+// gpgFormat is git's gpg.format for a signature format
+func gpgFormat(format string) string {
+	if format == SignGPG {
+		return "openpgp"
+	}
+	return format
+}
+
+func (g Exec) SignatureStatus(ctx context.Context, dir, rev string) (string, error) {
+	// %G? doesn't tell unsigned commits from SSH signatures that can't be checked, so look for the signature first
+	raw, err := g.run(ctx, "cat-file", dir, "cat-file", "commit", rev)
+	if err != nil {
+		return "", err
+	}
+	header, _, _ := strings.Cut(raw, "\n\n")
+	if !strings.Contains(header, "\ngpgsig ") && !strings.Contains(header, "\ngpgsig-sha256 ") {
+		return SignatureNone, nil
+	}
+	// verification failures are reported by %G?, not the exit status
+	output, err := g.run(ctx, "log", dir, "log", "-1", "--format=%G?", rev)
+	if err != nil {
+		return "", err
+	}
+	switch strings.TrimSpace(output) {
+	case "G", "U", "X", "Y":
+		return SignatureGood, nil
+	case "B", "R":
+		return SignatureBad, nil
+	}
+	return SignatureUnverified, nil
+}
+
+func (g Exec) Diff(ctx context.Context, dir, from, to string) (string, error) {
+	return g.run(ctx, "diff", dir, "diff", from, to)
+}
+
+func (g Exec) Push(ctx context.Context, dir, branch string) error {
+	_, err := g.run(ctx, "push", dir, "push", "-f", "origin", "HEAD:"+branch)
+	return err
+}
+
+func (g Exec) HeadSHA(ctx context.Context, dir string) (string, error) {
+	output, err := g.run(ctx, "rev-parse", dir, "rev-parse", "HEAD")
+	return strings.TrimSpace(output), err
+}
+
+func (g Exec) RevParse(ctx context.Context, dir, rev string) (string, error) {
+	output, err := g.run(ctx, "rev-parse", dir, "rev-parse", "--verify", rev+"^{commit}")
+	return strings.TrimSpace(output), err
+}
+
+func (g Exec) CurrentBranch(ctx context.Context, dir string) (string, error) {
+	output, err := g.run(ctx, "symbolic-ref", dir, "symbolic-ref", "--short", "HEAD")
+	return strings.TrimSpace(output), err
+}
+
+func (g Exec) Fetch(ctx context.Context, dir string) error {
+	_, err := g.run(ctx, "fetch", dir, "fetch", "--prune", "origin")
+	return err
+}
+
+func (g Exec) CherryPick(ctx context.Context, dir, commit string) error {
+	// `rev-list --parents` prints the commit followed by its parents
+	output, err := g.run(ctx, "rev-list", dir, "rev-list", "--parents", "-n", "1", commit)
+	if err != nil {
+		return err
+	}
+	args := []string{"cherry-pick", "-x"}
+	if len(strings.Fields(output)) > 2 {
+		args = append(args, "-m", "1")
+	}
+	if _, err := g.run(ctx, "cherry-pick", dir, append(args, commit)...); err != nil {
+		var gitErr *Error
+		if errors.As(err, &gitErr) && strings.Contains(gitErr.Output, "conflict") {
+			gitErr.Err = ErrConflict
+			g.run(ctx, "cherry-pick", dir, "cherry-pick", "--abort")
+		}
+		return err
+	}
+	return nil
+}
+
+func (g Exec) FormatPatch(ctx context.Context, dir, from, to, outDir string) ([]string, error) {
+	output, err := g.run(ctx, "format-patch", dir, "format-patch", "--output-directory", outDir, from+".."+to)
+	if err != nil {
+		return nil, err
+	}
+	// format-patch prints the path of every patch it writes
+	paths := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasSuffix(line, ".patch") {
+			paths = append(paths, line)
+		}
+	}
+	return paths, nil
+}
+
+func (g Exec) RemoteBranches(ctx context.Context, dir string) ([]string, error) {
+	output, err := g.run(ctx, "for-each-ref", dir, "for-each-ref", "--format=%(refname:lstrip=3)", "refs/remotes/origin")
+	if err != nil {
+		return nil, err
+	}
+	branches := []string{}
+	for _, branch := range strings.Split(strings.TrimSpace(output), "\n") {
+		if branch != "" && branch != "HEAD" {
+			branches = append(branches, branch)
+		}
+	}
+	return branches, nil
+}
+
+func (g Exec) AddWorktree(ctx context.Context, repoDir, dir, ref string) error {
+	_, err := g.run(ctx, "worktree add", repoDir, "worktree", "add", "--detach", dir, ref)
+	return err
+}
+
+func (g Exec) RemoveWorktree(ctx context.Context, repoDir, dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		if _, err := g.run(ctx, "worktree remove", repoDir, "worktree", "remove", "--force", "--force", dir); err != nil {
+			// dir isn't a worktree of repoDir, e.g. a plain copy made by an older version of microplane
+			if err := os.RemoveAll(dir); err != nil {
+				return &Error{Op: "worktree remove", Dir: repoDir, Err: err}
+			}
+		}
+	}
+	_, err := g.run(ctx, "worktree prune", repoDir, "worktree", "prune")
+	return err
+}
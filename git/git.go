@@ -0,0 +1,175 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os/exec"
+	"strings"
+)
+
+// Git is the set of git operations microplane needs to clone, plan and push repos.
+// Every method operates on the repository checked out in dir.
+type Git interface {
+	// Clone clones url into dir.
+	Clone(ctx context.Context, url, dir string) error
+	// CheckoutBranch points branch at HEAD and checks it out, keeping any changes in the worktree.
+	CheckoutBranch(ctx context.Context, dir, branch string) error
+	// AddAll stages all changes in the worktree, including deletions.
+	AddAll(ctx context.Context, dir string) error
+	// Commit commits the staged changes. It returns ErrNothingToCommit if nothing is staged and opts.AllowEmpty is false.
+	Commit(ctx context.Context, dir, message string, opts CommitOptions) error
+	// SignatureStatus returns whether rev is signed, and whether its signature checks out: one of the Signature* values.
+	SignatureStatus(ctx context.Context, dir, rev string) (string, error)
+	// Diff returns the unified diff between two revisions.
+	Diff(ctx context.Context, dir, from, to string) (string, error)
+	// Push force-pushes HEAD to branch on the origin remote.
+	Push(ctx context.Context, dir, branch string) error
+	// HeadSHA returns the SHA of the commit HEAD points to.
+	HeadSHA(ctx context.Context, dir string) (string, error)
+	// RevParse returns the SHA of the commit rev points to, e.g. "origin/main".
+	RevParse(ctx context.Context, dir, rev string) (string, error)
+	// CurrentBranch returns the name of the branch HEAD points to.
+	CurrentBranch(ctx context.Context, dir string) (string, error)
+	// Fetch updates the remote-tracking branches of the origin remote.
+	Fetch(ctx context.Context, dir string) error
+	// CherryPick applies the change introduced by commit on top of HEAD, as a new commit.
+	// Merge commits are picked relative to their first parent. It returns ErrConflict if the change doesn't apply cleanly.
+	CherryPick(ctx context.Context, dir, commit string) error
+	// FormatPatch writes the commits in from..to as patches in outDir, one `git format-patch` file per commit,
+	// and returns their paths in order.
+	FormatPatch(ctx context.Context, dir, from, to, outDir string) ([]string, error)
+	// RemoteBranches lists the branches of the origin remote, as of the last clone or fetch.
+	RemoteBranches(ctx context.Context, dir string) ([]string, error)
+	// AddWorktree checks out ref of the repo in repoDir into a new linked worktree at dir, with a detached HEAD.
+	// The worktree shares its objects and refs with repoDir, so creating it doesn't copy the repo's history.
+	AddWorktree(ctx context.Context, repoDir, dir, ref string) error
+	// RemoveWorktree deletes dir and unregisters it from repoDir. It is a no-op if dir doesn't exist.
+	RemoveWorktree(ctx context.Context, repoDir, dir string) error
+}
+
+var (
+	// ErrNothingToCommit is returned by Commit when there are no staged changes.
+	ErrNothingToCommit = errors.New("nothing to commit")
+	// ErrAuthentication is returned when the remote rejects our credentials.
+	ErrAuthentication = errors.New("authentication failed")
+	// ErrRepositoryNotFound is returned when the remote repository does not exist or is not visible to us.
+	ErrRepositoryNotFound = errors.New("repository not found")
+	// ErrConflict is returned when a change can't be applied without conflicts.
+	ErrConflict = errors.New("conflict")
+	// ErrUnsupported is returned when a backend cannot perform an operation.
+	ErrUnsupported = errors.New("operation not supported by this git backend")
+)
+
+// Identity of a commit's author or committer
+type Identity struct {
+	Name  string
+	Email string
+}
+
+// ParseIdentity parses an identity written as `Name <email>`
+func ParseIdentity(s string) (Identity, error) {
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Name == "" {
+		return Identity{}, fmt.Errorf("invalid identity '%s', must be 'Name <email>'", s)
+	}
+	return Identity{Name: addr.Name, Email: addr.Address}, nil
+}
+
+// IsZero is whether the identity is unset
+func (i Identity) IsZero() bool {
+	return i == Identity{}
+}
+
+func (i Identity) String() string {
+	return fmt.Sprintf("%s <%s>", i.Name, i.Email)
+}
+
+// Formats of commit signatures
+const (
+	SignGPG = "gpg"
+	SignSSH = "ssh"
+)
+
+// Signing configures how commits are signed
+type Signing struct {
+	// Format of the signature: SignGPG or SignSSH. Empty means commits aren't signed, unless the git config says so.
+	Format string
+	// Key to sign with: a GPG key ID, or an SSH key file. Defaults to the git config's user.signingkey.
+	Key string
+}
+
+// CommitOptions for Commit
+type CommitOptions struct {
+	// AllowEmpty commits even if nothing is staged
+	AllowEmpty bool
+	// Author of the commit, instead of the git config's identity
+	Author Identity
+	// Committer of the commit, instead of the git config's identity
+	Committer Identity
+	// Signoff adds a Signed-off-by trailer for the committer
+	Signoff bool
+	// Signing of the commit
+	Signing Signing
+}
+
+// Statuses returned by SignatureStatus
+const (
+	// SignatureGood means the commit's signature was made by a known key
+	SignatureGood = "good"
+	// SignatureBad means the commit's signature doesn't match it, or its key was revoked
+	SignatureBad = "bad"
+	// SignatureUnverified means the commit is signed, but the signature can't be checked, e.g. because the key isn't known
+	SignatureUnverified = "unverified"
+	// SignatureNone means the commit isn't signed
+	SignatureNone = "none"
+)
+
+// Error describes a failed git operation.
+type Error struct {
+	// Op is the git operation that failed, e.g. "clone" or "push"
+	Op string
+	// Dir is the repository the operation ran in
+	Dir string
+	// Output is the combined output of the git binary, if there was one
+	Output string
+	// Err is the underlying error. It wraps one of the Err* values above when the failure was recognized.
+	Err error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("git %s: %s", e.Op, e.Err)
+	if output := strings.TrimSpace(e.Output); output != "" {
+		msg = fmt.Sprintf("%s:\n%s", msg, output)
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Backends that can be passed to New
+const (
+	BackendAuto  = "auto"
+	BackendExec  = "exec"
+	BackendGoGit = "go-git"
+)
+
+// New returns the Git implementation for backend.
+// BackendAuto uses the git binary when it is installed, and go-git otherwise.
+func New(backend string) (Git, error) {
+	switch backend {
+	case BackendAuto, "":
+		if _, err := exec.LookPath("git"); err == nil {
+			return Exec{}, nil
+		}
+		return &GoGit{}, nil
+	case BackendExec:
+		return Exec{}, nil
+	case BackendGoGit:
+		return &GoGit{}, nil
+	}
+	return nil, fmt.Errorf("unknown git backend '%s', must be one of: %s, %s, %s", backend, BackendAuto, BackendExec, BackendGoGit)
+}
@@ -0,0 +1,300 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newOrigin creates a repo with a single commit to clone from
+func newOrigin(t *testing.T) string {
+	dir := t.TempDir()
+	repo, err := gogit.PlainInit(dir, false)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("hello\n"), 0644))
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+	_, err = wt.Add("README.md")
+	require.NoError(t, err)
+	_, err = wt.Commit("initial commit", &gogit.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+	return dir
+}
+
+// setIdentity configures a committer identity in the clone, so tests don't depend on the machine's git config
+func setIdentity(t *testing.T, dir string) {
+	repo, err := gogit.PlainOpen(dir)
+	require.NoError(t, err)
+	cfg, err := repo.Config()
+	require.NoError(t, err)
+	cfg.User.Name = "test"
+	cfg.User.Email = "test@example.com"
+	require.NoError(t, repo.SetConfig(cfg))
+}
+
+func testBackend(t *testing.T, g Git) {
+	ctx := context.Background()
+	origin := newOrigin(t)
+	cloneDir := filepath.Join(t.TempDir(), "cloned")
+	require.NoError(t, g.Clone(ctx, origin, cloneDir))
+	setIdentity(t, cloneDir)
+
+	branch, err := g.CurrentBranch(ctx, cloneDir)
+	require.NoError(t, err)
+	assert.Equal(t, "master", branch)
+	branches, err := g.RemoteBranches(ctx, cloneDir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"master"}, branches)
+
+	// make all changes in a worktree, like plan does
+	dir := filepath.Join(t.TempDir(), "planned")
+	require.NoError(t, g.AddWorktree(ctx, cloneDir, dir, "origin/master"))
+	defer func() {
+		require.NoError(t, g.RemoveWorktree(ctx, cloneDir, dir))
+		_, err := os.Stat(dir)
+		assert.True(t, os.IsNotExist(err))
+	}()
+	_, err = g.CurrentBranch(ctx, dir)
+	assert.Error(t, err, "worktree HEAD should be detached")
+	bs, err := os.ReadFile(filepath.Join(dir, "README.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", string(bs))
+
+	err = g.Commit(ctx, dir, "empty", CommitOptions{})
+	assert.True(t, errors.Is(err, ErrNothingToCommit), "expected ErrNothingToCommit, got %v", err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("hello microplane\n"), 0644))
+	require.NoError(t, g.CheckoutBranch(ctx, dir, "microplaning"))
+	require.NoError(t, g.AddAll(ctx, dir))
+	require.NoError(t, g.Commit(ctx, dir, "change readme", CommitOptions{
+		Author:  Identity{Name: "Jane Doe", Email: "jane@example.com"},
+		Signoff: true,
+	}))
+
+	diff, err := g.Diff(ctx, dir, "HEAD^", "HEAD")
+	require.NoError(t, err)
+	assert.Contains(t, diff, "+hello microplane")
+	assert.Contains(t, diff, "-hello")
+
+	sha, err := g.HeadSHA(ctx, dir)
+	require.NoError(t, err)
+	status, err := g.SignatureStatus(ctx, dir, sha)
+	require.NoError(t, err)
+	assert.Equal(t, SignatureNone, status)
+	branchSHA, err := g.RevParse(ctx, cloneDir, "microplaning")
+	require.NoError(t, err)
+	assert.Equal(t, sha, branchSHA)
+	_, err = g.RevParse(ctx, cloneDir, "origin/missing")
+	assert.Error(t, err)
+	require.NoError(t, g.Push(ctx, dir, "microplaning"))
+
+	originRepo, err := gogit.PlainOpen(origin)
+	require.NoError(t, err)
+	ref, err := originRepo.Reference(plumbing.NewBranchReferenceName("microplaning"), false)
+	require.NoError(t, err)
+	assert.Equal(t, sha, ref.Hash().String())
+	commit, err := originRepo.CommitObject(ref.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, "Jane Doe", commit.Author.Name)
+	assert.Equal(t, "test", commit.Committer.Name)
+	assert.Equal(t, "change readme\n\nSigned-off-by: test <test@example.com>\n", commit.Message)
+}
+
+func TestGoGit(t *testing.T) {
+	testBackend(t, &GoGit{})
+}
+
+func TestExec(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	testBackend(t, Exec{})
+}
+
+func TestCloneMissingRepo(t *testing.T) {
+	err := (&GoGit{}).Clone(context.Background(), filepath.Join(t.TempDir(), "missing"), filepath.Join(t.TempDir(), "cloned"))
+	var gitErr *Error
+	require.True(t, errors.As(err, &gitErr))
+	assert.Equal(t, "clone", gitErr.Op)
+	assert.True(t, errors.Is(err, ErrRepositoryNotFound), "expected ErrRepositoryNotFound, got %v", err)
+}
+
+func TestClassify(t *testing.T) {
+	err := errors.New("exit status 128")
+	for output, expected := range map[string]error{
+		"remote: Repository not found.\nfatal: repository 'https://github.com/o/r/' not found": ErrRepositoryNotFound,
+		"fatal: repository '/tmp/missing' does not exist":                                      ErrRepositoryNotFound,
+		"fatal: 'origin' does not appear to be a git repository":                               ErrRepositoryNotFound,
+		"fatal: invalid reference: release/1.0\nerror: pathspec 'x' does not exist":            err,
+		"fatal: Authentication failed for 'https://github.com/o/r/'":                           ErrAuthentication,
+	} {
+		assert.Equal(t, expected, classify(output, err), output)
+	}
+}
+
+func TestGoGitAuth(t *testing.T) {
+	g := &GoGit{Credentials: func(host string) (string, string) {
+		if host == "github.com" {
+			return "x-access-token", "token"
+		}
+		return "", ""
+	}}
+	assert.Equal(t, &http.BasicAuth{Username: "x-access-token", Password: "token"}, g.auth("https://github.com/o/r.git"))
+	// credentials are only sent to their own host, and never over ssh
+	assert.Nil(t, g.auth("https://gitlab.com/o/r.git"))
+	assert.Nil(t, g.auth("https://github.com.evil.example/o/r.git"))
+	assert.Nil(t, g.auth("git@github.com:o/r.git"))
+}
+
+func TestWorktreeInterop(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	ctx := context.Background()
+	cloneDir := filepath.Join(t.TempDir(), "cloned")
+	require.NoError(t, Exec{}.Clone(ctx, newOrigin(t), cloneDir))
+
+	// a worktree made by go-git is usable by, and removable with, the git binary
+	dir := filepath.Join(t.TempDir(), "planned")
+	require.NoError(t, (&GoGit{}).AddWorktree(ctx, cloneDir, dir, "HEAD"))
+	status, err := Exec{}.run(ctx, "status", dir, "status", "--porcelain")
+	require.NoError(t, err)
+	assert.Empty(t, status)
+	list, err := Exec{}.run(ctx, "worktree list", cloneDir, "worktree", "list")
+	require.NoError(t, err)
+	assert.Contains(t, list, dir)
+
+	require.NoError(t, Exec{}.RemoveWorktree(ctx, cloneDir, dir))
+	list, err = Exec{}.run(ctx, "worktree list", cloneDir, "worktree", "list")
+	require.NoError(t, err)
+	assert.NotContains(t, list, dir)
+}
+
+func TestExecCherryPick(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	ctx := context.Background()
+	g := Exec{}
+	cloneDir := filepath.Join(t.TempDir(), "cloned")
+	require.NoError(t, g.Clone(ctx, newOrigin(t), cloneDir))
+	setIdentity(t, cloneDir)
+
+	// make a fix on master...
+	require.NoError(t, os.WriteFile(filepath.Join(cloneDir, "fix.txt"), []byte("fix\n"), 0644))
+	require.NoError(t, g.AddAll(ctx, cloneDir))
+	require.NoError(t, g.Commit(ctx, cloneDir, "fix", CommitOptions{}))
+	fix, err := g.HeadSHA(ctx, cloneDir)
+	require.NoError(t, err)
+
+	// ...and pick it onto the previous commit
+	dir := filepath.Join(t.TempDir(), "backported")
+	require.NoError(t, g.AddWorktree(ctx, cloneDir, dir, "HEAD^"))
+	require.NoError(t, g.CherryPick(ctx, dir, fix))
+	bs, err := os.ReadFile(filepath.Join(dir, "fix.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "fix\n", string(bs))
+
+	// picking it again conflicts with itself
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "fix.txt"), []byte("other fix\n"), 0644))
+	require.NoError(t, g.AddAll(ctx, dir))
+	require.NoError(t, g.Commit(ctx, dir, "other fix", CommitOptions{}))
+	err = g.CherryPick(ctx, dir, fix)
+	assert.True(t, errors.Is(err, ErrConflict), "expected ErrConflict, got %v", err)
+
+	assert.True(t, errors.Is((&GoGit{}).CherryPick(ctx, dir, fix), ErrUnsupported))
+}
+
+func TestExecFormatPatch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	ctx := context.Background()
+	g := Exec{}
+	cloneDir := filepath.Join(t.TempDir(), "cloned")
+	require.NoError(t, g.Clone(ctx, newOrigin(t), cloneDir))
+	setIdentity(t, cloneDir)
+	base, err := g.HeadSHA(ctx, cloneDir)
+	require.NoError(t, err)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(cloneDir, name), []byte(name+"\n"), 0644))
+		require.NoError(t, g.AddAll(ctx, cloneDir))
+		require.NoError(t, g.Commit(ctx, cloneDir, "Add "+name, CommitOptions{}))
+	}
+
+	outDir := filepath.Join(t.TempDir(), "patches dir")
+	paths, err := g.FormatPatch(ctx, cloneDir, base, "HEAD", outDir)
+	require.NoError(t, err)
+	require.Len(t, paths, 2)
+	assert.Equal(t, filepath.Join(outDir, "0001-Add-a.txt.patch"), paths[0])
+	bs, err := os.ReadFile(paths[1])
+	require.NoError(t, err)
+	assert.Contains(t, string(bs), "Subject: [PATCH 2/2] Add b.txt")
+
+	_, err = (&GoGit{}).FormatPatch(ctx, cloneDir, base, "HEAD", outDir)
+	assert.True(t, errors.Is(err, ErrUnsupported))
+}
+
+func TestParseIdentity(t *testing.T) {
+	identity, err := ParseIdentity("Jane Doe <jane@example.com>")
+	require.NoError(t, err)
+	assert.Equal(t, Identity{Name: "Jane Doe", Email: "jane@example.com"}, identity)
+	assert.Equal(t, "Jane Doe <jane@example.com>", identity.String())
+
+	for _, s := range []string{"jane@example.com", "Jane Doe", ""} {
+		_, err := ParseIdentity(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestExecSign(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen is not installed")
+	}
+	ctx := context.Background()
+	g := Exec{}
+	dir := filepath.Join(t.TempDir(), "cloned")
+	require.NoError(t, g.Clone(ctx, newOrigin(t), dir))
+	setIdentity(t, dir)
+	key := filepath.Join(t.TempDir(), "key")
+	out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", key).CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	require.NoError(t, g.Commit(ctx, dir, "signed", CommitOptions{AllowEmpty: true, Signing: Signing{Format: SignSSH, Key: key}}))
+	status, err := g.SignatureStatus(ctx, dir, "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, SignatureUnverified, status)
+
+	// trusting the key verifies the signature
+	publicKey, err := os.ReadFile(key + ".pub")
+	require.NoError(t, err)
+	allowedSigners := filepath.Join(t.TempDir(), "allowed_signers")
+	require.NoError(t, os.WriteFile(allowedSigners, append([]byte("test@example.com "), publicKey...), 0644))
+	_, err = g.run(ctx, "config", dir, "config", "gpg.ssh.allowedSignersFile", allowedSigners)
+	require.NoError(t, err)
+	status, err = g.SignatureStatus(ctx, dir, "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, SignatureGood, status)
+
+	err = (&GoGit{}).Commit(ctx, dir, "signed", CommitOptions{AllowEmpty: true, Signing: Signing{Format: SignSSH, Key: key}})
+	assert.True(t, errors.Is(err, ErrUnsupported))
+	status, err = (&GoGit{}).SignatureStatus(ctx, dir, "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, SignatureUnverified, status)
+}
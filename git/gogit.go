@@ -0,0 +1,392 @@
+package git
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// GoGit implements Git in-process with go-git, so no git binary is required.
+type GoGit struct {
+	// Credentials returns the username and password for https remotes on a host, or an empty password for none.
+	// ssh remotes authenticate with the ssh agent.
+	Credentials func(host string) (username, password string)
+}
+
+func (g *GoGit) auth(remote string) transport.AuthMethod {
+	if g.Credentials == nil {
+		return nil
+	}
+	parsed, err := url.Parse(remote)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+		return nil
+	}
+	username, password := g.Credentials(parsed.Hostname())
+	if password == "" {
+		return nil
+	}
+	return &http.BasicAuth{Username: username, Password: password}
+}
+
+// wrap converts a go-git error into an *Error, mapping well-known failures to our typed errors.
+func (g *GoGit) wrap(op, dir string, err error) error {
+	switch {
+	case errors.Is(err, gogit.ErrEmptyCommit):
+		err = ErrNothingToCommit
+	case errors.Is(err, transport.ErrAuthenticationRequired), errors.Is(err, transport.ErrAuthorizationFailed):
+		err = ErrAuthentication
+	case errors.Is(err, transport.ErrRepositoryNotFound):
+		err = ErrRepositoryNotFound
+	}
+	return &Error{Op: op, Dir: dir, Err: err}
+}
+
+func (g *GoGit) open(op, dir string) (*gogit.Repository, *gogit.Worktree, error) {
+	// EnableDotGitCommonDir lets us open linked worktrees, see AddWorktree
+	repo, err := gogit.PlainOpenWithOptions(dir, &gogit.PlainOpenOptions{EnableDotGitCommonDir: true})
+	if err != nil {
+		return nil, nil, g.wrap(op, dir, err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, nil, g.wrap(op, dir, err)
+	}
+	return repo, wt, nil
+}
+
+func (g *GoGit) Clone(ctx context.Context, url, dir string) error {
+	_, err := gogit.PlainCloneContext(ctx, dir, false, &gogit.CloneOptions{
+		URL:  url,
+		Auth: g.auth(url),
+	})
+	if err != nil {
+		return g.wrap("clone", dir, err)
+	}
+	return nil
+}
+
+func (g *GoGit) CheckoutBranch(ctx context.Context, dir, branch string) error {
+	repo, wt, err := g.open("checkout", dir)
+	if err != nil {
+		return err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return g.wrap("checkout", dir, err)
+	}
+	ref := plumbing.NewHashReference(plumbing.NewBranchReferenceName(branch), head.Hash())
+	if err := repo.Storer.SetReference(ref); err != nil {
+		return g.wrap("checkout", dir, err)
+	}
+	if err := wt.Checkout(&gogit.CheckoutOptions{Branch: ref.Name(), Keep: true}); err != nil {
+		return g.wrap("checkout", dir, err)
+	}
+	return nil
+}
+
+func (g *GoGit) AddAll(ctx context.Context, dir string) error {
+	_, wt, err := g.open("add", dir)
+	if err != nil {
+		return err
+	}
+	if err := wt.AddWithOptions(&gogit.AddOptions{All: true}); err != nil {
+		return g.wrap("add", dir, err)
+	}
+	return nil
+}
+
+func (g *GoGit) Commit(ctx context.Context, dir, message string, opts CommitOptions) error {
+	if opts.Signing.Format != "" {
+		return g.wrap("commit", dir, ErrUnsupported)
+	}
+	repo, wt, err := g.open("commit", dir)
+	if err != nil {
+		return err
+	}
+	commitOpts := &gogit.CommitOptions{
+		AllowEmptyCommits: opts.AllowEmpty,
+		Author:            signature(opts.Author, "AUTHOR"),
+		Committer:         signature(opts.Committer, "COMMITTER"),
+	}
+	if commitOpts.Committer == nil {
+		// like the git binary, and unlike go-git, commit as the git config's identity rather than the author
+		cfg, err := repo.ConfigScoped(config.SystemScope)
+		if err != nil {
+			return g.wrap("commit", dir, err)
+		}
+		if cfg.User.Name != "" && cfg.User.Email != "" {
+			commitOpts.Committer = &object.Signature{Name: cfg.User.Name, Email: cfg.User.Email, When: time.Now()}
+		}
+	}
+	if opts.Signoff {
+		committer := commitOpts.Committer
+		if committer == nil {
+			committer = commitOpts.Author
+		}
+		if committer == nil {
+			return g.wrap("commit", dir, errors.New("no identity to sign off with"))
+		}
+		message = strings.TrimRight(message, "\n") + fmt.Sprintf("\n\nSigned-off-by: %s <%s>\n", committer.Name, committer.Email)
+	}
+	if _, err := wt.Commit(message, commitOpts); err != nil {
+		return g.wrap("commit", dir, err)
+	}
+	return nil
+}
+
+// signature is identity, if set. Otherwise it reads one from the GIT_{AUTHOR,COMMITTER}_{NAME,EMAIL} variables the git binary honors.
+// It returns nil if they aren't set either, leaving go-git to fall back to the user's git config.
+func signature(identity Identity, role string) *object.Signature {
+	if !identity.IsZero() {
+		return &object.Signature{Name: identity.Name, Email: identity.Email, When: time.Now()}
+	}
+	name, email := os.Getenv("GIT_"+role+"_NAME"), os.Getenv("GIT_"+role+"_EMAIL")
+	if name == "" || email == "" {
+		return nil
+	}
+	return &object.Signature{Name: name, Email: email, When: time.Now()}
+}
+
+// SignatureStatus can tell signed commits from unsigned ones, but not check signatures without a keyring
+func (g *GoGit) SignatureStatus(ctx context.Context, dir, rev string) (string, error) {
+	repo, _, err := g.open("verify-commit", dir)
+	if err != nil {
+		return "", err
+	}
+	commit, err := g.commit(repo, rev)
+	if err != nil {
+		return "", g.wrap("verify-commit", dir, err)
+	}
+	if commit.PGPSignature == "" {
+		return SignatureNone, nil
+	}
+	return SignatureUnverified, nil
+}
+
+func (g *GoGit) Diff(ctx context.Context, dir, from, to string) (string, error) {
+	repo, _, err := g.open("diff", dir)
+	if err != nil {
+		return "", err
+	}
+	fromCommit, err := g.commit(repo, from)
+	if err != nil {
+		return "", g.wrap("diff", dir, err)
+	}
+	toCommit, err := g.commit(repo, to)
+	if err != nil {
+		return "", g.wrap("diff", dir, err)
+	}
+	patch, err := fromCommit.PatchContext(ctx, toCommit)
+	if err != nil {
+		return "", g.wrap("diff", dir, err)
+	}
+	return patch.String(), nil
+}
+
+func (g *GoGit) commit(repo *gogit.Repository, rev string) (*object.Commit, error) {
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", rev, err)
+	}
+	return repo.CommitObject(*hash)
+}
+
+func (g *GoGit) Push(ctx context.Context, dir, branch string) error {
+	repo, _, err := g.open("push", dir)
+	if err != nil {
+		return err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return g.wrap("push", dir, err)
+	}
+	if !head.Name().IsBranch() {
+		return g.wrap("push", dir, errors.New("HEAD is detached, nothing to push"))
+	}
+	remote, err := repo.Remote("origin")
+	if err != nil {
+		return g.wrap("push", dir, err)
+	}
+	refSpec := config.RefSpec(fmt.Sprintf("+%s:%s", head.Name(), plumbing.NewBranchReferenceName(branch)))
+	err = repo.PushContext(ctx, &gogit.PushOptions{
+		RemoteName: "origin",
+		RefSpecs:   []config.RefSpec{refSpec},
+		Auth:       g.auth(remote.Config().URLs[0]),
+	})
+	if err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
+		return g.wrap("push", dir, err)
+	}
+	return nil
+}
+
+func (g *GoGit) HeadSHA(ctx context.Context, dir string) (string, error) {
+	repo, _, err := g.open("rev-parse", dir)
+	if err != nil {
+		return "", err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", g.wrap("rev-parse", dir, err)
+	}
+	return head.Hash().String(), nil
+}
+
+func (g *GoGit) RevParse(ctx context.Context, dir, rev string) (string, error) {
+	repo, _, err := g.open("rev-parse", dir)
+	if err != nil {
+		return "", err
+	}
+	commit, err := g.commit(repo, rev)
+	if err != nil {
+		return "", g.wrap("rev-parse", dir, err)
+	}
+	return commit.Hash.String(), nil
+}
+
+func (g *GoGit) CurrentBranch(ctx context.Context, dir string) (string, error) {
+	repo, _, err := g.open("symbolic-ref", dir)
+	if err != nil {
+		return "", err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", g.wrap("symbolic-ref", dir, err)
+	}
+	if !head.Name().IsBranch() {
+		return "", g.wrap("symbolic-ref", dir, errors.New("HEAD is detached"))
+	}
+	return head.Name().Short(), nil
+}
+
+func (g *GoGit) Fetch(ctx context.Context, dir string) error {
+	repo, _, err := g.open("fetch", dir)
+	if err != nil {
+		return err
+	}
+	remote, err := repo.Remote("origin")
+	if err != nil {
+		return g.wrap("fetch", dir, err)
+	}
+	err = remote.FetchContext(ctx, &gogit.FetchOptions{
+		Auth:  g.auth(remote.Config().URLs[0]),
+		Prune: true,
+	})
+	if err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
+		return g.wrap("fetch", dir, err)
+	}
+	return nil
+}
+
+// CherryPick isn't implemented by go-git
+func (g *GoGit) CherryPick(ctx context.Context, dir, commit string) error {
+	return g.wrap("cherry-pick", dir, ErrUnsupported)
+}
+
+// FormatPatch isn't implemented by go-git
+func (g *GoGit) FormatPatch(ctx context.Context, dir, from, to, outDir string) ([]string, error) {
+	return nil, g.wrap("format-patch", dir, ErrUnsupported)
+}
+
+func (g *GoGit) RemoteBranches(ctx context.Context, dir string) ([]string, error) {
+	repo, _, err := g.open("for-each-ref", dir)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := repo.References()
+	if err != nil {
+		return nil, g.wrap("for-each-ref", dir, err)
+	}
+	branches := []string{}
+	prefix := "refs/remotes/origin/"
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().String()
+		if strings.HasPrefix(name, prefix) && name != prefix+"HEAD" {
+			branches = append(branches, strings.TrimPrefix(name, prefix))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, g.wrap("for-each-ref", dir, err)
+	}
+	return branches, nil
+}
+
+// AddWorktree lays out a linked worktree the same way `git worktree add` does,
+// so that worktrees created by either backend can be used and removed by the other.
+func (g *GoGit) AddWorktree(ctx context.Context, repoDir, dir, ref string) error {
+	repo, _, err := g.open("worktree add", repoDir)
+	if err != nil {
+		return err
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return g.wrap("worktree add", repoDir, fmt.Errorf("resolving %s: %w", ref, err))
+	}
+	absRepoDir, err := filepath.Abs(repoDir)
+	if err != nil {
+		return g.wrap("worktree add", repoDir, err)
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return g.wrap("worktree add", repoDir, err)
+	}
+
+	// {repoDir}/.git/worktrees/{name} holds the worktree's HEAD and index, everything else is shared
+	adminDir := filepath.Join(absRepoDir, ".git", "worktrees", worktreeName(absDir))
+	files := map[string]string{
+		filepath.Join(adminDir, "HEAD"):      hash.String() + "\n",
+		filepath.Join(adminDir, "commondir"): "../..\n",
+		filepath.Join(adminDir, "gitdir"):    filepath.Join(absDir, ".git") + "\n",
+		filepath.Join(absDir, ".git"):        "gitdir: " + adminDir + "\n",
+	}
+	for path, contents := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return g.wrap("worktree add", repoDir, err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			return g.wrap("worktree add", repoDir, err)
+		}
+	}
+
+	_, wt, err := g.open("worktree add", absDir)
+	if err != nil {
+		return err
+	}
+	if err := wt.Checkout(&gogit.CheckoutOptions{Hash: *hash, Force: true}); err != nil {
+		return g.wrap("worktree add", repoDir, err)
+	}
+	return nil
+}
+
+func (g *GoGit) RemoveWorktree(ctx context.Context, repoDir, dir string) error {
+	// a linked worktree's .git file points at its admin dir in repoDir, which must go too
+	if bs, err := os.ReadFile(filepath.Join(dir, ".git")); err == nil && strings.HasPrefix(string(bs), "gitdir: ") {
+		adminDir := strings.TrimSpace(strings.TrimPrefix(string(bs), "gitdir: "))
+		if err := os.RemoveAll(adminDir); err != nil {
+			return g.wrap("worktree remove", repoDir, err)
+		}
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return g.wrap("worktree remove", repoDir, err)
+	}
+	return nil
+}
+
+// worktreeName derives a unique admin dir name for a worktree, since many worktrees share a basename (e.g. "planned")
+func worktreeName(absDir string) string {
+	sum := sha1.Sum([]byte(absDir))
+	return fmt.Sprintf("%s-%x", filepath.Base(absDir), sum[:4])
+}
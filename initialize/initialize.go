@@ -31,6 +31,8 @@ type Input struct {
 type Output struct {
 	Version string
 	Repos   []lib.Repo
+	// Vars are the per-repo variables from the repos file, keyed by "{owner}/{name}"
+	Vars map[string]map[string]string `json:",omitempty"`
 }
 
 // ByName allows sorting repos by name
@@ -49,10 +51,11 @@ func Initialize(input Input) (Output, error) {
 	})
 
 	var repos []lib.Repo
+	var vars map[string]map[string]string
 	var err error
 	if input.ReposFromFile != "" {
 		// Read repos from file
-		repos, err = reposFromFile(p, input.ReposFromFile)
+		repos, vars, err = reposFromFile(p, input.ReposFromFile)
 	} else if input.RepoSearch {
 		// Do search with Repo type only
 		repos, err = githubRepoSearch(p, input.Query)
@@ -79,6 +82,7 @@ func Initialize(input Input) (Output, error) {
 	return Output{
 		Version: input.Version,
 		Repos:   repos,
+		Vars:    vars,
 	}, nil
 }
 
@@ -97,24 +101,38 @@ func dedupe(repos []lib.Repo) []lib.Repo {
 	return out
 }
 
-func reposFromFile(p *lib.Provider, file string) ([]lib.Repo, error) {
+// reposFromFile reads lines of the form '{org}/{repo} [key=value ...]',
+// returning the repos and the variables given for them, keyed by '{org}/{repo}'
+func reposFromFile(p *lib.Provider, file string) ([]lib.Repo, map[string]map[string]string, error) {
 	// read file
 	bs, err := ioutil.ReadFile(file)
 	if err != nil {
-		return []lib.Repo{}, err
+		return []lib.Repo{}, nil, err
 	}
 
 	repos := []lib.Repo{}
+	vars := map[string]map[string]string{}
 	items := strings.Split(string(bs), "\n")
 	for _, item := range items {
-		if item == "" {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
 			// in case file ends with newline, ignore it
 			continue
 		}
 		// GitLab may have nested directories
-		parts := strings.SplitN(item, "/", 2)
+		parts := strings.SplitN(fields[0], "/", 2)
 		if len(parts) != 2 {
-			return []lib.Repo{}, fmt.Errorf("unable determine repo from line, expected format '{org}/{repo}': %s", item)
+			return []lib.Repo{}, nil, fmt.Errorf("unable determine repo from line, expected format '{org}/{repo}': %s", item)
+		}
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return []lib.Repo{}, nil, fmt.Errorf("unable to parse variable '%s', expected format 'key=value': %s", field, item)
+			}
+			if vars[fields[0]] == nil {
+				vars[fields[0]] = map[string]string{}
+			}
+			vars[fields[0]][kv[0]] = kv[1]
 		}
 		repos = append(repos, lib.Repo{
 			Owner:          parts[0],
@@ -122,7 +140,10 @@ func reposFromFile(p *lib.Provider, file string) ([]lib.Repo, error) {
 			ProviderConfig: p.ProviderConfig,
 		})
 	}
-	return repos, nil
+	if len(vars) == 0 {
+		vars = nil
+	}
+	return repos, vars, nil
 }
 
 // githubSearch queries github and returns a list of matching repos
@@ -0,0 +1,45 @@
+package initialize
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Clever/microplane/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReposFromFile(t *testing.T) {
+	p := &lib.Provider{ProviderConfig: lib.ProviderConfig{Backend: "github"}}
+	file := filepath.Join(t.TempDir(), "repos.txt")
+	require.NoError(t, os.WriteFile(file, []byte("clever/repo1 team=eng-apps tier=1\nclever/repo2\n\ngroup/sub/repo3  url=https://x?a=b  empty=\n"), 0644))
+
+	repos, vars, err := reposFromFile(p, file)
+	require.NoError(t, err)
+	assert.Equal(t, []lib.Repo{
+		{Owner: "clever", Name: "repo1", ProviderConfig: p.ProviderConfig},
+		{Owner: "clever", Name: "repo2", ProviderConfig: p.ProviderConfig},
+		{Owner: "group", Name: "sub/repo3", ProviderConfig: p.ProviderConfig},
+	}, repos)
+	assert.Equal(t, map[string]map[string]string{
+		"clever/repo1":    {"team": "eng-apps", "tier": "1"},
+		"group/sub/repo3": {"url": "https://x?a=b", "empty": ""},
+	}, vars)
+
+	// without any variables
+	require.NoError(t, os.WriteFile(file, []byte("clever/repo1\n"), 0644))
+	_, vars, err = reposFromFile(p, file)
+	require.NoError(t, err)
+	assert.Nil(t, vars)
+
+	for line, msg := range map[string]string{
+		"clever/repo1 team":      "unable to parse variable 'team'",
+		"clever/repo1 =eng-apps": "unable to parse variable '=eng-apps'",
+		"repo1 team=eng-apps":    "expected format '{org}/{repo}'",
+	} {
+		require.NoError(t, os.WriteFile(file, []byte(line+"\n"), 0644))
+		_, _, err = reposFromFile(p, file)
+		assert.ErrorContains(t, err, msg, line)
+	}
+}
@@ -3,6 +3,7 @@ package lib
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"os"
 
 	"github.com/google/go-github/v35/github"
@@ -21,6 +22,18 @@ func (pc ProviderConfig) IsEnterprise() bool {
 	return pc.BackendURL != ""
 }
 
+// Hostname is the host serving the provider's repos, e.g. github.com or the enterprise URL's host
+func (pc ProviderConfig) Hostname() (string, error) {
+	if !pc.IsEnterprise() {
+		return fmt.Sprintf("%s.com", pc.Backend), nil
+	}
+	parsed, err := url.Parse(pc.BackendURL)
+	if err != nil {
+		return "", err
+	}
+	return parsed.Hostname(), nil
+}
+
 // Provider is an abstraction over a Git provider (Github, Gitlab, etc)
 type Provider struct {
 	ProviderConfig
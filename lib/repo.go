@@ -11,6 +11,23 @@ type Repo struct {
 	Owner    string
 	CloneURL string // consider if we can remove this. ComputedCloneURL is a first step
 	ProviderConfig
+	// BaseBranch is only set when the repo is planned against several base branches.
+	// Each base branch then gets its own workflow state, see StateName.
+	BaseBranch string `json:",omitempty"`
+}
+
+// StateName is the name of the workdir directory holding the repo's workflow state
+func (r Repo) StateName() string {
+	if r.BaseBranch == "" {
+		return r.Name
+	}
+	return r.Name + "@" + EscapeBranch(r.BaseBranch)
+}
+
+// EscapeBranch turns a branch name into a directory name, percent-encoding "/" (and "%"),
+// so that different branches, e.g. release/1.0 and release_1.0, never share a directory
+func EscapeBranch(branch string) string {
+	return url.PathEscape(branch)
 }
 
 func (r Repo) IsGithub() bool {
@@ -28,13 +45,9 @@ func (r Repo) ComputedCloneURL() (string, error) {
 	}
 
 	// Otherwise, make our best guess!
-	hostname := fmt.Sprintf("%s.com", r.ProviderConfig.Backend)
-	if r.ProviderConfig.IsEnterprise() {
-		parsed, err := url.Parse(r.ProviderConfig.BackendURL)
-		if err != nil {
-			return "", err
-		}
-		hostname = parsed.Hostname()
+	hostname, err := r.ProviderConfig.Hostname()
+	if err != nil {
+		return "", err
 	}
 	return fmt.Sprintf("git@%s:%s/%s", hostname, r.Owner, r.Name), nil
 }
@@ -0,0 +1,15 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateName(t *testing.T) {
+	assert.Equal(t, "app", Repo{Name: "app"}.StateName())
+	assert.Equal(t, "app@main", Repo{Name: "app", BaseBranch: "main"}.StateName())
+	assert.Equal(t, "app@release%2F1.0", Repo{Name: "app", BaseBranch: "release/1.0"}.StateName())
+	assert.Equal(t, "app@release_1.0", Repo{Name: "app", BaseBranch: "release_1.0"}.StateName())
+	assert.Equal(t, "app@release%252F1.0", Repo{Name: "app", BaseBranch: "release%2F1.0"}.StateName())
+}
@@ -0,0 +1,121 @@
+package plan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Limits constrains the resources the change command may use. Zero values mean no limit.
+type Limits struct {
+	// CPU time the command may use, rounded up to the second
+	CPU time.Duration
+	// MemoryBytes of virtual memory the command may use
+	MemoryBytes int64
+}
+
+// waitDelay is how long to wait for a killed command's children to release its output
+const waitDelay = 10 * time.Second
+
+// KilledError is returned when the change command is killed, because it timed out or exceeded its limits
+type KilledError struct {
+	Reason string
+	Output string
+}
+
+func (e *KilledError) Error() string {
+	return fmt.Sprintf("[%s] %s", e.Reason, e.Output)
+}
+
+func timedOut(timeout time.Duration) string {
+	return fmt.Sprintf("timed out after %s", timeout)
+}
+
+// wrap returns a command that applies the limits with `ulimit`, then execs into cmd
+func (l Limits) wrap(cmd Command) Command {
+	ulimits := []string{}
+	if l.CPU > 0 {
+		ulimits = append(ulimits, fmt.Sprintf("ulimit -t %d", int64((l.CPU+time.Second-1)/time.Second)))
+	}
+	if l.MemoryBytes > 0 {
+		ulimits = append(ulimits, fmt.Sprintf("ulimit -v %d", (l.MemoryBytes+1023)/1024))
+	}
+	if len(ulimits) == 0 {
+		return cmd
+	}
+	script := strings.Join(append(ulimits, `exec "$0" "$@"`), " && ")
+	return Command{Path: "sh", Args: append([]string{"-c", script, cmd.Path}, cmd.Args...)}
+}
+
+// runCommand runs a change command in dir with the extra env vars, enforcing the input's limits and sandbox.
+// The input's timeout is ctx's deadline, set by Plan for the whole change.
+func runCommand(ctx context.Context, input Input, command Command, dir string, extraEnv []string) error {
+	env := append(os.Environ(), extraEnv...)
+	cmd, env, err := input.Sandbox.wrap(input.Limits.wrap(command), env, input.WorkDir, dir)
+	if err != nil {
+		return err
+	}
+	execCmd := exec.CommandContext(ctx, cmd.Path, cmd.Args...)
+	execCmd.Dir = dir
+	execCmd.WaitDelay = waitDelay
+	execCmd.Env = env
+	if input.Sandbox.Mode == SandboxContainer {
+		// killing the runtime's CLI would leave the container running, so have it stop the container instead
+		execCmd.Cancel = func() error { return execCmd.Process.Signal(os.Interrupt) }
+	}
+
+	// save the output to the logs, keeping it for the error too
+	stdoutLog, err := openLog(input.WorkDir, StdoutLog)
+	if err != nil {
+		return err
+	}
+	defer stdoutLog.Close()
+	stderrLog, err := openLog(input.WorkDir, StderrLog)
+	if err != nil {
+		return err
+	}
+	defer stderrLog.Close()
+	stdoutLog.header(command)
+	stderrLog.header(command)
+	var combined lockedBuffer
+	execCmd.Stdout = io.MultiWriter(stdoutLog, &combined)
+	execCmd.Stderr = io.MultiWriter(stderrLog, &combined)
+	err = execCmd.Run()
+	if err == nil {
+		return nil
+	}
+	output := combined.String()
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &KilledError{Reason: timedOut(input.Timeout), Output: output}
+	}
+	var exerr *exec.ExitError
+	if !errors.As(err, &exerr) {
+		return err
+	}
+	if status, ok := exerr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		reason := fmt.Sprintf("killed by signal: %s", status.Signal())
+		if input.Limits != (Limits{}) {
+			reason += fmt.Sprintf(" (limits: %s)", input.Limits)
+		}
+		return &KilledError{Reason: reason, Output: output}
+	}
+	return fmt.Errorf("[%s] %s", exerr, output)
+}
+
+func (l Limits) String() string {
+	limits := []string{}
+	if l.CPU > 0 {
+		limits = append(limits, fmt.Sprintf("cpu %s", l.CPU))
+	}
+	if l.MemoryBytes > 0 {
+		limits = append(limits, fmt.Sprintf("memory %dMiB", l.MemoryBytes/(1024*1024)))
+	}
+	return strings.Join(limits, ", ")
+}
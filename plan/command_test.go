@@ -0,0 +1,62 @@
+package plan
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCommand(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	input := Input{WorkDir: t.TempDir()}
+
+	err := runCommand(ctx, input, Command{Path: "sh", Args: []string{"-c", "exit 0"}}, dir, nil)
+	assert.NoError(t, err)
+
+	err = runCommand(ctx, input, Command{Path: "sh", Args: []string{"-c", "echo oops; exit 3"}}, dir, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exit status 3")
+	assert.Contains(t, err.Error(), "oops")
+}
+
+func TestRunCommandTimeout(t *testing.T) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := runCommand(ctx, Input{
+		WorkDir: t.TempDir(),
+		Timeout: 100 * time.Millisecond,
+	}, Command{Path: "sleep", Args: []string{"10"}}, t.TempDir(), nil)
+
+	var killed *KilledError
+	require.True(t, errors.As(err, &killed), "expected KilledError, got %v", err)
+	assert.Equal(t, "timed out after 100ms", killed.Reason)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestRunCommandCPULimit(t *testing.T) {
+	err := runCommand(context.Background(), Input{
+		WorkDir: t.TempDir(),
+		Timeout: 30 * time.Second,
+		Limits:  Limits{CPU: time.Second},
+	}, Command{Path: "sh", Args: []string{"-c", "while :; do :; done"}}, t.TempDir(), nil)
+
+	var killed *KilledError
+	require.True(t, errors.As(err, &killed), "expected KilledError, got %v", err)
+	assert.Contains(t, killed.Reason, "killed by signal")
+	assert.Contains(t, killed.Reason, "limits: cpu 1s")
+}
+
+func TestLimitsWrap(t *testing.T) {
+	cmd := Command{Path: "make", Args: []string{"test"}}
+	assert.Equal(t, cmd, Limits{}.wrap(cmd))
+	assert.Equal(t, Command{
+		Path: "sh",
+		Args: []string{"-c", `ulimit -t 2 && ulimit -v 1024 && exec "$0" "$@"`, "make", "test"},
+	}, Limits{CPU: 1500 * time.Millisecond, MemoryBytes: 1024 * 1024}.wrap(cmd))
+}
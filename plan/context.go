@@ -0,0 +1,67 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Clever/microplane/lib"
+)
+
+// Context describes the repo being planned to the change command.
+// It is written as JSON to the file named by MICROPLANE_CONTEXT.
+type Context struct {
+	Repo          lib.Repo
+	FullName      string
+	DefaultBranch string
+	BaseBranch    string
+	BaseSHA       string
+	Campaign      string
+	BranchName    string
+	// Vars given for the repo in the repos file passed to `mp init`
+	Vars map[string]string
+}
+
+// contextFile is where the Context is written, relative to the WorkDir.
+// It's outside the worktree, so it isn't committed.
+const contextFile = "context.json"
+
+// env returns the MICROPLANE_<X> convenience env vars for the context, for use in user's script
+func (c Context) env(contextPath string) []string {
+	vars := [][2]string{
+		{"MICROPLANE_REPO", c.Repo.Name},
+		{"MICROPLANE_OWNER", c.Repo.Owner},
+		{"MICROPLANE_FULL_NAME", c.FullName},
+		{"MICROPLANE_PROVIDER", c.Repo.ProviderConfig.Backend},
+		{"MICROPLANE_PROVIDER_URL", c.Repo.ProviderConfig.BackendURL},
+		{"MICROPLANE_DEFAULT_BRANCH", c.DefaultBranch},
+		{"MICROPLANE_BASE_BRANCH", c.BaseBranch},
+		{"MICROPLANE_BASE_SHA", c.BaseSHA},
+		{"MICROPLANE_CAMPAIGN", c.Campaign},
+		{"MICROPLANE_BRANCH", c.BranchName},
+		{"MICROPLANE_CONTEXT", contextPath},
+		{"MICROPLANE_VALUES", filepath.Join(filepath.Dir(contextPath), valuesFile)},
+	}
+	env := []string{}
+	for _, kv := range vars {
+		env = append(env, fmt.Sprintf("%s=%s", kv[0], kv[1]))
+	}
+	return env
+}
+
+// write saves the context into workDir, returning its absolute path
+func (c Context) write(workDir string) (string, error) {
+	contextPath, err := filepath.Abs(filepath.Join(workDir, contextFile))
+	if err != nil {
+		return "", err
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(contextPath, b, 0644); err != nil {
+		return "", err
+	}
+	return contextPath, nil
+}
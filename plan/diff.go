@@ -0,0 +1,48 @@
+package plan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DiffFile is where the git diff of the change is saved, relative to the WorkDir.
+// Keeping it out of the plan's output keeps the output small, however large the diff.
+const DiffFile = "diff.patch"
+
+// writeDiff saves the diff to DiffFile, recording its path, hash and stats in output
+func writeDiff(workDir, diff string, output *Output) error {
+	diffPath, err := filepath.Abs(filepath.Join(workDir, DiffFile))
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(diffPath, []byte(diff), 0644); err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(diff))
+	output.DiffPath = diffPath
+	output.DiffSHA = hex.EncodeToString(sum[:])
+	output.DiffStat = ParseDiffStat(diff)
+	return nil
+}
+
+// OpenDiff opens the diff of the planned change, to stream it. A plan that failed before diffing has an empty diff.
+// Plans made before DiffFile have their diff in GitDiff instead.
+func (o Output) OpenDiff() (io.ReadCloser, error) {
+	if o.DiffPath == "" {
+		return io.NopCloser(strings.NewReader(o.GitDiff)), nil
+	}
+	return os.Open(o.DiffPath)
+}
+
+// ReadDiff reads the whole diff of the planned change
+func (o Output) ReadDiff() (string, error) {
+	if o.DiffPath == "" {
+		return o.GitDiff, nil
+	}
+	b, err := os.ReadFile(o.DiffPath)
+	return string(b), err
+}
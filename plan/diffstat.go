@@ -0,0 +1,124 @@
+package plan
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiffStat summarizes a diff, like `git diff --stat`
+type DiffStat struct {
+	Files      []FileStat
+	Insertions int
+	Deletions  int
+}
+
+// FileStat is the change made to one file
+type FileStat struct {
+	Path string
+	// OldPath of a renamed file
+	OldPath    string `json:",omitempty"`
+	Insertions int
+	Deletions  int
+	// Binary files have no line counts
+	Binary bool `json:",omitempty"`
+}
+
+// ParseDiffStat reads the stats of a unified diff, as made by `git diff`
+func ParseDiffStat(diff string) DiffStat {
+	stat := DiffStat{Files: []FileStat{}}
+	var file *FileStat
+	inHunk := false
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			stat.Files = append(stat.Files, FileStat{Path: diffGitPath(line)})
+			file = &stat.Files[len(stat.Files)-1]
+			inHunk = false
+		case file == nil:
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+		case inHunk && strings.HasPrefix(line, "+"):
+			file.Insertions++
+			stat.Insertions++
+		case inHunk && strings.HasPrefix(line, "-"):
+			file.Deletions++
+			stat.Deletions++
+		case inHunk:
+		case strings.HasPrefix(line, "rename from "):
+			file.OldPath = strings.TrimPrefix(line, "rename from ")
+		case strings.HasPrefix(line, "rename to "):
+			file.Path = strings.TrimPrefix(line, "rename to ")
+		case strings.HasPrefix(line, "+++ b/"):
+			// git ends paths containing spaces with a tab
+			file.Path = strings.TrimSuffix(strings.TrimPrefix(line, "+++ b/"), "\t")
+		case strings.HasPrefix(line, "Binary files "), line == "GIT binary patch":
+			file.Binary = true
+		}
+	}
+	return stat
+}
+
+// diffGitPath is the new path in a "diff --git a/<old> b/<new>" line.
+// It's overridden by the "+++" or "rename to" lines that follow, unless the file is binary or only renamed.
+func diffGitPath(line string) string {
+	paths := strings.TrimPrefix(line, "diff --git ")
+	if i := strings.LastIndex(paths, " b/"); i >= 0 {
+		return paths[i+len(" b/"):]
+	}
+	return paths
+}
+
+// Size is the number of lines inserted and deleted
+func (s DiffStat) Size() int {
+	return s.Insertions + s.Deletions
+}
+
+// Binary counts the binary files changed
+func (s DiffStat) Binary() int {
+	n := 0
+	for _, f := range s.Files {
+		if f.Binary {
+			n++
+		}
+	}
+	return n
+}
+
+// Renamed counts the files renamed
+func (s DiffStat) Renamed() int {
+	n := 0
+	for _, f := range s.Files {
+		if f.OldPath != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// String summarizes the stats, e.g. "3 file(s) changed, +10 -2 (1 binary, 1 renamed)"
+func (s DiffStat) String() string {
+	summary := fmt.Sprintf("%d file(s) changed, +%d -%d", len(s.Files), s.Insertions, s.Deletions)
+	extra := []string{}
+	if n := s.Binary(); n > 0 {
+		extra = append(extra, fmt.Sprintf("%d binary", n))
+	}
+	if n := s.Renamed(); n > 0 {
+		extra = append(extra, fmt.Sprintf("%d renamed", n))
+	}
+	if len(extra) > 0 {
+		summary += " (" + strings.Join(extra, ", ") + ")"
+	}
+	return summary
+}
+
+// String describes the change to the file, e.g. "old.go => new.go +3 -1"
+func (f FileStat) String() string {
+	path := f.Path
+	if f.OldPath != "" {
+		path = f.OldPath + " => " + f.Path
+	}
+	if f.Binary {
+		return path + " (binary)"
+	}
+	return fmt.Sprintf("%s +%d -%d", path, f.Insertions, f.Deletions)
+}
@@ -0,0 +1,70 @@
+package plan
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDiffStat(t *testing.T) {
+	diff := "diff --git a/bin b/bin\n" +
+		"index bdc955b..8835708 100644\n" +
+		"Binary files a/bin and b/bin differ\n" +
+		"diff --git a/gone b/gone\n" +
+		"deleted file mode 100644\n" +
+		"index 587be6b..0000000\n" +
+		"--- a/gone\n" +
+		"+++ /dev/null\n" +
+		"@@ -1 +0,0 @@\n" +
+		"-x\n" +
+		"diff --git a/old.txt b/new.txt\n" +
+		"similarity index 83%\n" +
+		"rename from old.txt\n" +
+		"rename to new.txt\n" +
+		"index 0fdf397..e0318ee 100644\n" +
+		"--- a/old.txt\n" +
+		"+++ b/new.txt\n" +
+		"@@ -3,4 +3,4 @@ b\n" +
+		" c\n" +
+		" d\n" +
+		" e\n" +
+		"-f\n" +
+		"+F\n" +
+		"diff --git a/sp ace.txt b/sp ace.txt\n" +
+		"new file mode 100644\n" +
+		"index 0000000..e4238df\n" +
+		"--- /dev/null\n" +
+		"+++ b/sp ace.txt\t\n" +
+		"@@ -0,0 +1 @@\n" +
+		"+++x\n"
+
+	stat := ParseDiffStat(diff)
+	assert.Equal(t, []FileStat{
+		{Path: "bin", Binary: true},
+		{Path: "gone", Deletions: 1},
+		{Path: "new.txt", OldPath: "old.txt", Insertions: 1, Deletions: 1},
+		{Path: "sp ace.txt", Insertions: 1},
+	}, stat.Files)
+	assert.Equal(t, 2, stat.Insertions)
+	assert.Equal(t, 2, stat.Deletions)
+	assert.Equal(t, "4 file(s) changed, +2 -2 (1 binary, 1 renamed)", stat.String())
+	assert.Equal(t, "old.txt => new.txt +1 -1", stat.Files[2].String())
+
+	assert.Equal(t, DiffStat{Files: []FileStat{}}, ParseDiffStat(""))
+}
+
+func TestReadDiffOfOlderPlans(t *testing.T) {
+	diff := "diff --git a/a b/a\n--- a/a\n+++ b/a\n@@ -1 +1 @@\n-x\n+y\n"
+	output := Output{GitDiff: diff}
+	read, err := output.ReadDiff()
+	assert.NoError(t, err)
+	assert.Equal(t, diff, read)
+
+	r, err := output.OpenDiff()
+	assert.NoError(t, err)
+	defer r.Close()
+	streamed, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, diff, string(streamed))
+}
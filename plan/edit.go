@@ -0,0 +1,295 @@
+package plan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Edit operations
+const (
+	// EditSet sets the value at a path. The path's parent must exist.
+	EditSet = "set"
+	// EditDelete deletes the value at a path
+	EditDelete = "delete"
+	// EditAppend appends a value to the list at a path
+	EditAppend = "append"
+)
+
+// EditAction is one change made by an Edit
+type EditAction struct {
+	// Op is one of EditSet, EditDelete or EditAppend
+	Op string `yaml:"op"`
+	// Path to the value, e.g. `spec.containers[0].image`
+	Path string `yaml:"path"`
+	// Value to set or append, in YAML syntax, e.g. `1`, `"1"`, `[a, b]` or `{a: 1}`
+	Value string `yaml:"value,omitempty"`
+}
+
+// Edit is an Operation making structured changes to YAML, JSON and TOML files.
+// Comments and key order are kept. Every action must apply to every file, or the edit fails.
+type Edit struct {
+	// Files are glob patterns, relative to the repo root, of the files to edit. `**` matches any number of directories.
+	Files []string `yaml:"files"`
+	// Actions are applied in order
+	Actions []EditAction `yaml:"actions"`
+}
+
+// pathElem is one step of a path: a key, or an index into a list
+type pathElem struct {
+	Key     string
+	Index   int
+	IsIndex bool
+}
+
+func (e pathElem) String() string {
+	if e.IsIndex {
+		return fmt.Sprintf("[%d]", e.Index)
+	}
+	return e.Key
+}
+
+// parsePath parses paths like `a.b[0].c`
+func parsePath(path string) ([]pathElem, error) {
+	elems := []pathElem{}
+	for _, part := range strings.Split(path, ".") {
+		key := part
+		indices := ""
+		if i := strings.Index(part, "["); i != -1 {
+			key, indices = part[:i], part[i:]
+		}
+		if key == "" && (indices == "" || len(elems) == 0) {
+			return nil, fmt.Errorf("invalid path '%s': empty key", path)
+		}
+		if key != "" {
+			elems = append(elems, pathElem{Key: key})
+		}
+		for indices != "" {
+			end := strings.Index(indices, "]")
+			if indices[0] != '[' || end == -1 {
+				return nil, fmt.Errorf("invalid path '%s': expected [index]", path)
+			}
+			index, err := strconv.Atoi(indices[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid path '%s': invalid index '%s'", path, indices[1:end])
+			}
+			elems = append(elems, pathElem{Index: index, IsIndex: true})
+			indices = indices[end+1:]
+		}
+	}
+	return elems, nil
+}
+
+func formatPath(path []pathElem) string {
+	s := ""
+	for i, e := range path {
+		if i > 0 && !e.IsIndex {
+			s += "."
+		}
+		s += e.String()
+	}
+	return s
+}
+
+// parseValue parses a value in YAML syntax. Values that aren't valid YAML, like `>=20`, are strings.
+func parseValue(value string) *yaml.Node {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &doc); err != nil || len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+	}
+	return doc.Content[0]
+}
+
+// scalarText returns an !!int, !!float or !!bool scalar in the syntax JSON and TOML share, converting YAML-only
+// forms like 0x10, True or .inf. Infinities and NaN, which only TOML has, are inf, -inf and nan.
+func scalarText(node *yaml.Node) (string, error) {
+	if node.ShortTag() == "!!bool" {
+		var b bool
+		if err := node.Decode(&b); err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(b), nil
+	}
+	if number := []byte(node.Value); json.Valid(number) {
+		return node.Value, nil
+	}
+	var i int64
+	if node.ShortTag() == "!!int" && node.Decode(&i) == nil {
+		return strconv.FormatInt(i, 10), nil
+	}
+	var f float64
+	if err := node.Decode(&f); err != nil {
+		return "", err
+	}
+	switch {
+	case math.IsInf(f, 1):
+		return "inf", nil
+	case math.IsInf(f, -1):
+		return "-inf", nil
+	case math.IsNaN(f):
+		return "nan", nil
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64), nil
+}
+
+// NewEdit validates the edit's paths and values
+func NewEdit(files []string, actions []EditAction) (*Edit, error) {
+	if err := validateGlobs(files); err != nil {
+		return nil, err
+	}
+	if len(actions) == 0 {
+		return nil, fmt.Errorf("no edits to make")
+	}
+	for _, a := range actions {
+		if _, err := parsePath(a.Path); err != nil {
+			return nil, err
+		}
+		switch a.Op {
+		case EditSet, EditAppend, EditDelete:
+		default:
+			return nil, fmt.Errorf("unknown edit '%s', must be one of: %s, %s, %s", a.Op, EditSet, EditDelete, EditAppend)
+		}
+	}
+	return &Edit{Files: files, Actions: actions}, nil
+}
+
+// Apply edits every matching file in dir, counting the actions applied per file in output.Edits
+func (e *Edit) Apply(ctx context.Context, dir string, changeCtx Context, output *Output) error {
+	files, err := matchFiles(dir, e.Files)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no files match %s", strings.Join(e.Files, ", "))
+	}
+	if output.Edits == nil {
+		output.Edits = map[string]int{}
+	}
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		var edited []byte
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".yml", ".yaml":
+			edited, err = editYAML(contents, e.Actions)
+		case ".json":
+			edited, err = editJSON(contents, e.Actions)
+		case ".toml":
+			edited, err = editTOML(contents, e.Actions)
+		default:
+			err = fmt.Errorf("unsupported file type, must be YAML, JSON or TOML")
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, edited, info.Mode().Perm()); err != nil {
+			return err
+		}
+		output.Edits[file] += len(e.Actions)
+	}
+	return nil
+}
+
+func applyAction(root *yaml.Node, op string, path []pathElem, value *yaml.Node) error {
+	parent, err := lookup(root, path[:len(path)-1])
+	if err != nil {
+		return err
+	}
+	last := path[len(path)-1]
+
+	switch op {
+	case EditSet:
+		if i, ok := find(parent, last); ok {
+			keepStyle(parent.Content[i], value)
+			parent.Content[i] = value
+			return nil
+		}
+		if parent.Kind == yaml.MappingNode && !last.IsIndex {
+			parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: last.Key}, value)
+			return nil
+		}
+	case EditDelete:
+		if i, ok := find(parent, last); ok {
+			if parent.Kind == yaml.MappingNode {
+				parent.Content = append(parent.Content[:i-1], parent.Content[i+1:]...)
+			} else {
+				parent.Content = append(parent.Content[:i], parent.Content[i+1:]...)
+			}
+			return nil
+		}
+	case EditAppend:
+		if i, ok := find(parent, last); ok {
+			list := resolveAlias(parent.Content[i])
+			if list.Kind != yaml.SequenceNode {
+				return fmt.Errorf("%s is not a list", formatPath(path))
+			}
+			list.Content = append(list.Content, value)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s not found", formatPath(path))
+}
+
+// lookup returns the node at path
+func lookup(node *yaml.Node, path []pathElem) (*yaml.Node, error) {
+	for i, elem := range path {
+		j, ok := find(node, elem)
+		if !ok {
+			return nil, fmt.Errorf("%s not found", formatPath(path[:i+1]))
+		}
+		node = resolveAlias(node.Content[j])
+	}
+	return node, nil
+}
+
+// find returns the index in node.Content of the value for elem
+func find(node *yaml.Node, elem pathElem) (int, bool) {
+	node = resolveAlias(node)
+	switch {
+	case node.Kind == yaml.MappingNode && !elem.IsIndex:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == elem.Key {
+				return i + 1, true
+			}
+		}
+	case node.Kind == yaml.SequenceNode && elem.IsIndex:
+		if elem.Index < len(node.Content) {
+			return elem.Index, true
+		}
+	}
+	return 0, false
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	if node.Kind == yaml.AliasNode {
+		return node.Alias
+	}
+	return node
+}
+
+// keepStyle carries over the comments, and the quoting of strings, of the value being replaced
+func keepStyle(old, value *yaml.Node) {
+	value.HeadComment, value.LineComment, value.FootComment = old.HeadComment, old.LineComment, old.FootComment
+	if old.Kind == yaml.ScalarNode && value.Kind == yaml.ScalarNode && old.ShortTag() == "!!str" && value.ShortTag() == "!!str" {
+		value.Style = old.Style
+	}
+}
@@ -0,0 +1,326 @@
+package plan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// JSON files are edited in place like YAML ones: only the text of the edited values is rewritten.
+
+// jsonValue is a value in a JSON document and where its text is
+type jsonValue struct {
+	// kind is '{', '[' or 0 for scalars
+	kind       byte
+	start, end int
+	members    []jsonMember
+}
+
+// jsonMember is a key and value in an object, or an element of an array
+type jsonMember struct {
+	key string
+	// start of the key, or of the value in an array
+	start int
+	value *jsonValue
+}
+
+// jsonParser locates the values in a JSON document. It expects valid JSON.
+type jsonParser struct {
+	src []byte
+	pos int
+}
+
+func (p *jsonParser) skipSpace() {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) != -1 {
+		p.pos++
+	}
+}
+
+func (p *jsonParser) value() (*jsonValue, error) {
+	p.skipSpace()
+	v := &jsonValue{start: p.pos}
+	switch c := p.src[p.pos]; c {
+	case '{', '[':
+		v.kind = c
+		p.pos++
+		for {
+			p.skipSpace()
+			if p.src[p.pos] == '}' || p.src[p.pos] == ']' {
+				p.pos++
+				break
+			}
+			m := jsonMember{start: p.pos}
+			if c == '{' {
+				keyEnd := p.stringEnd()
+				if err := json.Unmarshal(p.src[p.pos:keyEnd], &m.key); err != nil {
+					return nil, err
+				}
+				p.pos = keyEnd
+				p.skipSpace()
+				// the colon
+				p.pos++
+			}
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			m.value = value
+			v.members = append(v.members, m)
+			p.skipSpace()
+			if p.src[p.pos] == ',' {
+				p.pos++
+			}
+		}
+	case '"':
+		p.pos = p.stringEnd()
+	default:
+		for p.pos < len(p.src) && strings.IndexByte(",]} \t\r\n", p.src[p.pos]) == -1 {
+			p.pos++
+		}
+	}
+	v.end = p.pos
+	return v, nil
+}
+
+// stringEnd returns the offset after the string starting at pos
+func (p *jsonParser) stringEnd() int {
+	for i := p.pos + 1; i < len(p.src); i++ {
+		switch p.src[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(p.src)
+}
+
+// find returns the index of the member for elem
+func (v *jsonValue) find(elem pathElem) (int, bool) {
+	switch {
+	case v.kind == '{' && !elem.IsIndex:
+		for i, m := range v.members {
+			if m.key == elem.Key {
+				return i, true
+			}
+		}
+	case v.kind == '[' && elem.IsIndex:
+		if elem.Index < len(v.members) {
+			return elem.Index, true
+		}
+	}
+	return 0, false
+}
+
+// editJSON applies the actions to a JSON file, keeping the text of the values left alone
+func editJSON(contents []byte, actions []EditAction) ([]byte, error) {
+	if len(bytes.TrimSpace(contents)) == 0 {
+		return nil, fmt.Errorf("empty file")
+	}
+	indent := jsonIndent(contents)
+	for _, a := range actions {
+		if !json.Valid(contents) {
+			return nil, fmt.Errorf("invalid JSON")
+		}
+		path, err := parsePath(a.Path)
+		if err != nil {
+			return nil, err
+		}
+		p := &jsonParser{src: contents}
+		root, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if contents, err = applyJSON(contents, root, indent, a.Op, path, parseValue(a.Value)); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", a.Op, a.Path, err)
+		}
+	}
+	return contents, nil
+}
+
+func applyJSON(contents []byte, root *jsonValue, indent, op string, path []pathElem, value *yaml.Node) ([]byte, error) {
+	parent := root
+	for i, elem := range path[:len(path)-1] {
+		j, ok := parent.find(elem)
+		if !ok {
+			return nil, fmt.Errorf("%s not found", formatPath(path[:i+1]))
+		}
+		parent = parent.members[j].value
+	}
+	last := path[len(path)-1]
+	i, found := parent.find(last)
+
+	splice := func(start, end int, text string) []byte {
+		return append(append(append([]byte{}, contents[:start]...), text...), contents[end:]...)
+	}
+	render := func(key *string, prefix string, inline bool) (string, error) {
+		var buf bytes.Buffer
+		if key != nil {
+			if err := writeJSONScalar(&buf, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: *key}); err != nil {
+				return "", err
+			}
+			buf.WriteString(": ")
+		}
+		step := indent
+		if inline {
+			prefix, step = "", ""
+		}
+		if err := writeJSON(&buf, value, step, prefix); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	// add puts a member at the end of parent, on its own line unless parent, or the whole file, fits on one
+	add := func(key *string) ([]byte, error) {
+		if len(parent.members) == 0 && !bytes.Contains(bytes.TrimSpace(contents), []byte("\n")) {
+			text, err := render(key, "", true)
+			if err != nil {
+				return nil, err
+			}
+			return splice(parent.start+1, parent.end-1, text), nil
+		}
+		if len(parent.members) == 0 {
+			prefix := lineIndent(contents, parent.start)
+			text, err := render(key, prefix+indent, false)
+			if err != nil {
+				return nil, err
+			}
+			return splice(parent.start+1, parent.end-1, "\n"+prefix+indent+text+"\n"+prefix), nil
+		}
+		m := parent.members[len(parent.members)-1]
+		inline := !bytes.Contains(contents[parent.start:parent.end], []byte("\n"))
+		text, err := render(key, lineIndent(contents, m.start), inline)
+		if err != nil {
+			return nil, err
+		}
+		if inline {
+			return splice(m.value.end, m.value.end, ", "+text), nil
+		}
+		return splice(m.value.end, m.value.end, ",\n"+lineIndent(contents, m.start)+text), nil
+	}
+
+	switch op {
+	case EditSet:
+		if found {
+			m := parent.members[i]
+			inline := !bytes.Contains(contents[parent.start:parent.end], []byte("\n"))
+			text, err := render(nil, lineIndent(contents, m.start), inline)
+			if err != nil {
+				return nil, err
+			}
+			return splice(m.value.start, m.value.end, text), nil
+		}
+		if parent.kind == '{' && !last.IsIndex {
+			return add(&last.Key)
+		}
+	case EditDelete:
+		if found {
+			switch {
+			case len(parent.members) == 1:
+				return splice(parent.start+1, parent.end-1, ""), nil
+			case i+1 < len(parent.members):
+				return splice(parent.members[i].start, parent.members[i+1].start, ""), nil
+			}
+			return splice(parent.members[i-1].value.end, parent.members[i].value.end, ""), nil
+		}
+	case EditAppend:
+		if found {
+			if parent.members[i].value.kind != '[' {
+				return nil, fmt.Errorf("%s is not a list", formatPath(path))
+			}
+			parent = parent.members[i].value
+			return add(nil)
+		}
+	}
+	return nil, fmt.Errorf("%s not found", formatPath(path))
+}
+
+// lineIndent returns the spaces or tabs starting the line containing offset at
+func lineIndent(contents []byte, at int) string {
+	start := bytes.LastIndexByte(contents[:at], '\n') + 1
+	line := contents[start:at]
+	return string(line[:len(line)-len(bytes.TrimLeft(line, " \t"))])
+}
+
+// jsonIndent returns the indentation of the first indented line of a JSON file
+func jsonIndent(contents []byte) string {
+	for _, line := range strings.Split(string(contents), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && len(trimmed) < len(line) {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return "  "
+}
+
+// writeJSON writes a node as JSON, one member per line, or all on one line if indent is empty
+func writeJSON(buf *bytes.Buffer, node *yaml.Node, indent, prefix string) error {
+	switch node.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		open, close, step := "[", "]", 1
+		if node.Kind == yaml.MappingNode {
+			open, close, step = "{", "}", 2
+		}
+		if len(node.Content) == 0 {
+			buf.WriteString(open + close)
+			return nil
+		}
+		newline, separator := "\n", ",\n"
+		if indent == "" {
+			newline, separator = "", ", "
+		}
+		buf.WriteString(open + newline)
+		for i := 0; i < len(node.Content); i += step {
+			buf.WriteString(prefix + indent)
+			if node.Kind == yaml.MappingNode {
+				if err := writeJSONScalar(buf, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: node.Content[i].Value}); err != nil {
+					return err
+				}
+				buf.WriteString(": ")
+			}
+			if err := writeJSON(buf, node.Content[i+step-1], indent, prefix+indent); err != nil {
+				return err
+			}
+			if i+step < len(node.Content) {
+				buf.WriteString(separator)
+			}
+		}
+		buf.WriteString(newline + prefix + close)
+		return nil
+	case yaml.ScalarNode:
+		return writeJSONScalar(buf, node)
+	case yaml.AliasNode:
+		return writeJSON(buf, node.Alias, indent, prefix)
+	}
+	return fmt.Errorf("can't write %s as JSON", node.Tag)
+}
+
+// writeJSONScalar writes a scalar as JSON. Other tags than numbers, booleans and null, like timestamps, are strings.
+func writeJSONScalar(buf *bytes.Buffer, node *yaml.Node) error {
+	switch node.ShortTag() {
+	case "!!int", "!!float", "!!bool":
+		text, err := scalarText(node)
+		if err != nil {
+			return err
+		}
+		if text == "inf" || text == "-inf" || text == "nan" {
+			return fmt.Errorf("%s can't be written as JSON", node.Value)
+		}
+		buf.WriteString(text)
+		return nil
+	case "!!null":
+		buf.WriteString("null")
+		return nil
+	}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(node.Value); err != nil {
+		return err
+	}
+	// Encode adds a newline
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
@@ -0,0 +1,527 @@
+package plan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TOML files are edited line by line, so that comments and formatting outside the edited values are kept.
+// Paths address keys in tables (`[a.b]`) and dotted keys (`a.b = 1`), but not keys in inline tables (`a = { b = 1 }`)
+// or arrays of tables (`[[a]]`), nor tables only defined by the header of a sub-table.
+
+// tomlEntry is a `key = value` line, or several lines for multi-line values
+type tomlEntry struct {
+	path       []string
+	start, end int
+	// table the entry is in
+	table *tomlTable
+	// inline is whether the value is an inline table
+	inline bool
+}
+
+// tomlTable is a `[table]` header and its entries. The root table has no header.
+type tomlTable struct {
+	path []string
+	// header is the line of the table's header, -1 for the root table
+	header int
+	// last is the last line of the table's entries, or its header if it has none
+	last int
+}
+
+type tomlDoc struct {
+	lines       []string
+	entries     []tomlEntry
+	tables      []*tomlTable
+	arrayTables [][]string
+}
+
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func editTOML(contents []byte, actions []EditAction) ([]byte, error) {
+	for _, a := range actions {
+		doc, err := parseTOML(string(contents))
+		if err != nil {
+			return nil, err
+		}
+		path, err := parsePath(a.Path)
+		if err != nil {
+			return nil, err
+		}
+		keys := []string{}
+		for _, elem := range path {
+			if elem.IsIndex {
+				return nil, fmt.Errorf("%s %s: list indexes aren't supported in TOML paths", a.Op, a.Path)
+			}
+			keys = append(keys, elem.Key)
+		}
+		value := ""
+		if a.Op != EditDelete {
+			if value, err = tomlValue(parseValue(a.Value)); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", a.Op, a.Path, err)
+			}
+		}
+		if err := doc.apply(a.Op, keys, value); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", a.Op, a.Path, err)
+		}
+		contents = []byte(strings.Join(doc.lines, "\n"))
+	}
+	return contents, nil
+}
+
+func parseTOML(contents string) (*tomlDoc, error) {
+	doc := &tomlDoc{lines: strings.Split(contents, "\n")}
+	current := &tomlTable{header: -1, last: -1}
+	doc.tables = append(doc.tables, current)
+	for i := 0; i < len(doc.lines); i++ {
+		line := doc.lines[i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed[0] == '#' {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[[") {
+			// entries of arrays of tables can't be addressed
+			end := strings.Index(trimmed, "]]")
+			if end == -1 {
+				return nil, fmt.Errorf("line %d: invalid table header", i+1)
+			}
+			path, err := parseTOMLKey(trimmed[2:end])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			doc.arrayTables = append(doc.arrayTables, path)
+			current = nil
+			continue
+		}
+		if trimmed[0] == '[' {
+			end := indexOutside(trimmed, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("line %d: invalid table header", i+1)
+			}
+			path, err := parseTOMLKey(trimmed[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			current = &tomlTable{path: path, header: i, last: i}
+			doc.tables = append(doc.tables, current)
+			continue
+		}
+
+		eq := indexOutside(line, '=')
+		if eq == -1 {
+			return nil, fmt.Errorf("line %d: expected 'key = value'", i+1)
+		}
+		key, err := parseTOMLKey(line[:eq])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		end, err := doc.valueEnd(i, eq+1)
+		if err != nil {
+			return nil, err
+		}
+		if current != nil {
+			path := append(append([]string{}, current.path...), key...)
+			inline := strings.HasPrefix(strings.TrimLeft(line[eq+1:], " \t"), "{")
+			doc.entries = append(doc.entries, tomlEntry{path: path, start: i, end: end, table: current, inline: inline})
+			current.last = end
+		}
+		i = end
+	}
+	return doc, nil
+}
+
+// valueEnd returns the last line of the value starting at line i, column col
+func (d *tomlDoc) valueEnd(i, col int) (int, error) {
+	value := strings.TrimLeft(d.lines[i][col:], " \t")
+	for _, delim := range []string{`"""`, `'''`} {
+		if strings.HasPrefix(value, delim) {
+			if strings.Contains(value[3:], delim) {
+				return i, nil
+			}
+			for j := i + 1; j < len(d.lines); j++ {
+				if strings.Contains(d.lines[j], delim) {
+					return j, nil
+				}
+			}
+			return 0, fmt.Errorf("line %d: unterminated multi-line string", i+1)
+		}
+	}
+	if !strings.HasPrefix(value, "[") {
+		return i, nil
+	}
+	line, _, err := d.closingBracket(i, len(d.lines[i])-len(value))
+	return line, err
+}
+
+// closingBracket finds the `]` closing the array opened at line i, column col
+func (d *tomlDoc) closingBracket(i, col int) (int, int, error) {
+	depth := 0
+	for j := i; j < len(d.lines); j++ {
+		line := d.lines[j]
+		for k := 0; k < len(line); k++ {
+			if j == i && k < col {
+				continue
+			}
+			switch line[k] {
+			case '"', '\'':
+				k = stringEnd(line, k)
+			case '#':
+				k = len(line)
+			case '[':
+				depth++
+			case ']':
+				depth--
+				if depth == 0 {
+					return j, k, nil
+				}
+			}
+		}
+	}
+	return 0, 0, fmt.Errorf("line %d: unterminated array", i+1)
+}
+
+// stringEnd returns the index of the quote closing the string opened at line[start]
+func stringEnd(line string, start int) int {
+	quote := line[start]
+	for k := start + 1; k < len(line); k++ {
+		if quote == '"' && line[k] == '\\' {
+			k++
+			continue
+		}
+		if line[k] == quote {
+			return k
+		}
+	}
+	return len(line)
+}
+
+// indexOutside returns the index of the first c in line that isn't in a string or comment
+func indexOutside(line string, c byte) int {
+	for k := 0; k < len(line); k++ {
+		switch line[k] {
+		case c:
+			return k
+		case '"', '\'':
+			k = stringEnd(line, k)
+		case '#':
+			return -1
+		}
+	}
+	return -1
+}
+
+// parseTOMLKey parses a dotted key like `a."b.c".d`
+func parseTOMLKey(text string) ([]string, error) {
+	keys := []string{}
+	for len(strings.TrimSpace(text)) > 0 {
+		text = strings.TrimLeft(text, " \t")
+		var key string
+		if text[0] == '"' || text[0] == '\'' {
+			end := stringEnd(text, 0)
+			if end == len(text) {
+				return nil, fmt.Errorf("invalid key: unterminated string")
+			}
+			key = text[1:end]
+			if text[0] == '"' {
+				unquoted, err := strconv.Unquote(text[:end+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid key %s: %w", text[:end+1], err)
+				}
+				key = unquoted
+			}
+			text = text[end+1:]
+		} else {
+			end := strings.IndexByte(text, '.')
+			if end == -1 {
+				end = len(text)
+			}
+			key = strings.TrimSpace(text[:end])
+			if !tomlBareKey.MatchString(key) {
+				return nil, fmt.Errorf("invalid key '%s'", key)
+			}
+			text = text[end:]
+		}
+		keys = append(keys, key)
+		text = strings.TrimLeft(text, " \t")
+		if text != "" {
+			if text[0] != '.' {
+				return nil, fmt.Errorf("invalid key: expected '.' before '%s'", text)
+			}
+			text = text[1:]
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("empty key")
+	}
+	return keys, nil
+}
+
+func formatTOMLKey(key string) string {
+	if tomlBareKey.MatchString(key) {
+		return key
+	}
+	return tomlString(key)
+}
+
+func tomlString(s string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// tomlValue formats a value parsed by parseValue as TOML
+func tomlValue(node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!int", "!!float", "!!bool":
+			return scalarText(node)
+		case "!!null":
+			return "", fmt.Errorf("TOML has no null value")
+		}
+		return tomlString(node.Value), nil
+	case yaml.SequenceNode:
+		values := []string{}
+		for _, n := range node.Content {
+			v, err := tomlValue(n)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, v)
+		}
+		return "[" + strings.Join(values, ", ") + "]", nil
+	case yaml.MappingNode:
+		values := []string{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			v, err := tomlValue(node.Content[i+1])
+			if err != nil {
+				return "", err
+			}
+			values = append(values, formatTOMLKey(node.Content[i].Value)+" = "+v)
+		}
+		if len(values) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(values, ", ") + " }", nil
+	}
+	return "", fmt.Errorf("can't write %s as TOML", node.Tag)
+}
+
+func samePath(a, b []string) bool {
+	return strings.Join(a, "\x00") == strings.Join(b, "\x00") && len(a) == len(b)
+}
+
+// hasPrefix is whether path starts with prefix, and is longer
+func hasPrefix(path, prefix []string) bool {
+	return len(path) > len(prefix) && samePath(path[:len(prefix)], prefix)
+}
+
+func (d *tomlDoc) findEntry(path []string) (tomlEntry, bool) {
+	for _, e := range d.entries {
+		if samePath(e.path, path) {
+			return e, true
+		}
+	}
+	return tomlEntry{}, false
+}
+
+func (d *tomlDoc) findTable(path []string) (*tomlTable, bool) {
+	for _, t := range d.tables {
+		if samePath(t.path, path) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// replaceLines replaces lines start through end with the given lines
+func (d *tomlDoc) replaceLines(start, end int, lines ...string) {
+	d.lines = append(d.lines[:start], append(lines, d.lines[end+1:]...)...)
+}
+
+// checkPath returns an error if path leads into a value, an inline table, or an array of tables
+func (d *tomlDoc) checkPath(path []string) error {
+	for _, e := range d.entries {
+		if !hasPrefix(path, e.path) {
+			continue
+		}
+		if e.inline {
+			return fmt.Errorf("%s is an inline table, editing inside inline tables is unsupported", strings.Join(e.path, "."))
+		}
+		return fmt.Errorf("%s is not a table", strings.Join(e.path, "."))
+	}
+	for _, table := range d.arrayTables {
+		if hasPrefix(path, table) || samePath(path, table) {
+			return fmt.Errorf("%s is an array of tables, editing arrays of tables is unsupported", strings.Join(table, "."))
+		}
+	}
+	return nil
+}
+
+// isTable is whether path is a table, with a header or defined by dotted keys
+func (d *tomlDoc) isTable(path []string) bool {
+	if _, ok := d.findTable(path); ok {
+		return true
+	}
+	for _, e := range d.entries {
+		if hasPrefix(e.path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *tomlDoc) apply(op string, path []string, value string) error {
+	if err := d.checkPath(path); err != nil {
+		return err
+	}
+	entry, found := d.findEntry(path)
+	if !found && d.isTable(path) {
+		return fmt.Errorf("%s is a table, only keys can be edited", strings.Join(path, "."))
+	}
+
+	switch op {
+	case EditSet:
+		if found {
+			line := d.lines[entry.start]
+			eq := indexOutside(line, '=')
+			prefix := line[:eq+1] + line[eq+1:len(line)-len(strings.TrimLeft(line[eq+1:], " \t"))]
+			d.replaceLines(entry.start, entry.end, prefix+value+trailingComment(d.lines[entry.end]))
+			return nil
+		}
+		parent := path[:len(path)-1]
+		if table, ok := d.findTable(parent); ok {
+			line := formatTOMLKey(path[len(path)-1]) + " = " + value
+			d.replaceLines(d.insertAt(table), d.insertAt(table)-1, line)
+			return nil
+		}
+		return d.addDottedKey(path, value)
+
+	case EditDelete:
+		if found {
+			d.replaceLines(entry.start, entry.end)
+			return nil
+		}
+
+	case EditAppend:
+		if found {
+			return d.appendToArray(entry, value)
+		}
+	}
+	return fmt.Errorf("%s not found", strings.Join(path, "."))
+}
+
+// addDottedKey adds a key to a table defined by dotted keys, after the last of them, e.g. `a.c = 2` after `a.b = 1`
+func (d *tomlDoc) addDottedKey(path []string, value string) error {
+	parent := path[:len(path)-1]
+	var last *tomlEntry
+	for i, e := range d.entries {
+		// the table is defined by the entry's key, not by the header of a sub-table
+		if hasPrefix(e.path, parent) && len(e.table.path) < len(parent) {
+			last = &d.entries[i]
+		}
+	}
+	if last == nil {
+		for _, t := range d.tables {
+			if hasPrefix(t.path, parent) {
+				return fmt.Errorf("%s is only defined by the header of [%s], adding keys to it is unsupported",
+					strings.Join(parent, "."), strings.Join(t.path, "."))
+			}
+		}
+		return fmt.Errorf("%s not found", strings.Join(parent, "."))
+	}
+	keys := []string{}
+	for _, key := range path[len(last.table.path):] {
+		keys = append(keys, formatTOMLKey(key))
+	}
+	line := d.lines[last.start]
+	indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	d.replaceLines(last.end+1, last.end, indent+strings.Join(keys, ".")+" = "+value)
+	return nil
+}
+
+// insertAt returns the line to add a key to the table at
+func (d *tomlDoc) insertAt(table *tomlTable) int {
+	if table.last != -1 {
+		return table.last + 1
+	}
+	// the root table has no entries yet: add it after any leading comments, before the first table
+	at := len(d.lines)
+	if len(d.tables) > 1 {
+		at = d.tables[1].header
+	} else if d.lines[at-1] == "" {
+		at--
+	}
+	for at > 0 && strings.TrimSpace(d.lines[at-1]) == "" {
+		at--
+	}
+	return at
+}
+
+// trailingComment returns the comment ending a line, with the whitespace before it
+func trailingComment(line string) string {
+	for k := 0; k < len(line); k++ {
+		switch line[k] {
+		case '"', '\'':
+			k = stringEnd(line, k)
+		case '#':
+			return line[len(strings.TrimRight(line[:k], " \t")):]
+		}
+	}
+	return ""
+}
+
+func (d *tomlDoc) appendToArray(entry tomlEntry, value string) error {
+	line := d.lines[entry.start]
+	eq := indexOutside(line, '=')
+	open := eq + 1 + len(line[eq+1:]) - len(strings.TrimLeft(line[eq+1:], " \t"))
+	if open >= len(line) || line[open] != '[' {
+		return fmt.Errorf("%s is not a list", strings.Join(entry.path, "."))
+	}
+	closeLine, closeCol, err := d.closingBracket(entry.start, open)
+	if err != nil {
+		return err
+	}
+
+	// `]` on its own line: add the value on a new line, after the last element
+	if closeLine > entry.start && strings.TrimSpace(d.lines[closeLine][:closeCol]) == "" {
+		last := closeLine - 1
+		for last > entry.start {
+			if content := strings.TrimSpace(d.lines[last]); content != "" && content[0] != '#' {
+				break
+			}
+			last--
+		}
+		lastLine := d.lines[last]
+		content := strings.TrimRight(lastLine[:len(lastLine)-len(trailingComment(lastLine))], " \t")
+		indent := lastLine[:len(lastLine)-len(strings.TrimLeft(lastLine, " \t"))]
+		if last == entry.start {
+			indent += "  "
+		} else if !strings.HasSuffix(content, ",") {
+			d.lines[last] = content + "," + trailingComment(lastLine)
+		}
+		d.replaceLines(last+1, last, indent+value+",")
+		return nil
+	}
+
+	// otherwise, insert the value before the `]`
+	closing := d.lines[closeLine]
+	before := strings.TrimRight(closing[:closeCol], " \t")
+	switch {
+	case strings.HasSuffix(before, "["):
+		before += value
+	case strings.HasSuffix(before, ","):
+		before += " " + value
+	default:
+		before += ", " + value
+	}
+	d.lines[closeLine] = before + closing[closeCol:]
+	return nil
+}
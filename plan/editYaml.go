@@ -0,0 +1,569 @@
+package plan
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YAML files are edited in place: only the text of the edited nodes is rewritten, so that everything else,
+// including comments, blank lines and indentation, is kept byte for byte.
+// Block mappings and sequences are edited line by line. Flow ones, like `{a: 1}`, are rewritten whole.
+
+// yamlText is the source of a YAML stream, to locate nodes in
+type yamlText struct {
+	src []byte
+	// lines are the offsets where each line starts
+	lines []int
+}
+
+func newYAMLText(src []byte) *yamlText {
+	t := &yamlText{src: src, lines: []int{0}}
+	for i, b := range src {
+		if b == '\n' {
+			t.lines = append(t.lines, i+1)
+		}
+	}
+	return t
+}
+
+// numLines counts the lines, not counting the empty one after a final newline
+func (t *yamlText) numLines() int {
+	n := len(t.lines)
+	if t.lines[n-1] == len(t.src) {
+		n--
+	}
+	return n
+}
+
+// line returns line n, counting from 1, without its newline
+func (t *yamlText) line(n int) string {
+	return string(t.src[t.lines[n-1]:t.lineEnd(n)])
+}
+
+// lineEnd returns the offset of the end of line n, before its newline
+func (t *yamlText) lineEnd(n int) int {
+	if n < len(t.lines) {
+		return t.lines[n] - 1
+	}
+	return len(t.src)
+}
+
+// offset returns the offset of a line and column, as reported by yaml.Node, counting runes from 1
+func (t *yamlText) offset(line, column int) int {
+	off := t.lines[line-1]
+	for c := 1; c < column && off < len(t.src) && t.src[off] != '\n'; c++ {
+		_, size := utf8.DecodeRune(t.src[off:])
+		off += size
+	}
+	return off
+}
+
+// atLineStart is whether only spaces precede column on line
+func (t *yamlText) atLineStart(line, column int) bool {
+	return strings.TrimLeft(t.line(line)[:t.offset(line, column)-t.lines[line-1]], " ") == ""
+}
+
+// yamlEntry is a node in a block mapping or sequence, spanning the lines from its key or `-` through its last line
+type yamlEntry struct {
+	node *yaml.Node
+	// key of the node in a mapping, nil in a sequence or for the document's root
+	key *yaml.Node
+	// dash is the offset of the `-` of the node in a sequence, -1 otherwise
+	dash      int
+	startLine int
+	endLine   int
+	// column of the key or `-`
+	column int
+}
+
+func (e yamlEntry) isRoot() bool {
+	return e.key == nil && e.dash == -1
+}
+
+// trimEnd drops the blank lines, and comments less indented than column, from the end of lines start through end
+func (t *yamlText) trimEnd(start, end, column int) int {
+	for end > start {
+		line := t.line(end)
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed == "..." || (strings.HasPrefix(trimmed, "#") && len(line)-len(trimmed) < column) {
+			end--
+			continue
+		}
+		break
+	}
+	return end
+}
+
+// entries locates the nodes of a block mapping or sequence, the value of parent
+func (t *yamlText) entries(parent yamlEntry) []yamlEntry {
+	node := parent.node
+	entries := []yamlEntry{}
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			entries = append(entries, yamlEntry{node: node.Content[i+1], key: key, dash: -1, startLine: key.Line, column: key.Column})
+		}
+	} else {
+		for _, item := range node.Content {
+			line := t.dashLine(item, node.Column)
+			entries = append(entries, yamlEntry{node: item, dash: t.offset(line, node.Column), startLine: line, column: node.Column})
+		}
+	}
+	for i := range entries {
+		end := parent.endLine
+		if i+1 < len(entries) {
+			end = entries[i+1].startLine - 1
+		}
+		entries[i].endLine = t.trimEnd(entries[i].startLine, end, entries[i].column)
+	}
+	return entries
+}
+
+// dashLine returns the line of the `-` at column introducing a sequence item
+func (t *yamlText) dashLine(item *yaml.Node, column int) int {
+	for line := item.Line; line > 1; line-- {
+		text := t.line(line)
+		if len(text) >= column && text[column-1] == '-' && (line == item.Line || t.atLineStart(line, column)) {
+			return line
+		}
+	}
+	return item.Line
+}
+
+// child returns the entry of the node at index i of parent's Content
+func (t *yamlText) child(parent yamlEntry, i int) yamlEntry {
+	if parent.node.Kind == yaml.MappingNode {
+		return t.entries(parent)[i/2]
+	}
+	return t.entries(parent)[i]
+}
+
+// isEmpty is whether a node has no text, like the value of `key:`
+func isEmpty(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Style == 0 && node.Value == "" && node.Tag == "!!null"
+}
+
+func isFlow(node *yaml.Node) bool {
+	return node.Style&yaml.FlowStyle != 0 || ((node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode) && len(node.Content) == 0)
+}
+
+func isBlockCollection(node *yaml.Node) bool {
+	return (node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode) && !isFlow(node)
+}
+
+// yamlEditor edits the documents of a YAML stream
+type yamlEditor struct {
+	text *yamlText
+	// indent of nested mappings, and of sequences in mappings, in the file
+	indent    int
+	seqIndent int
+	// edits to make, as offsets to replace and their new text, applied once the action is done
+	start, end int
+	replace    string
+}
+
+// editYAML applies the actions to every document in a YAML file
+func editYAML(contents []byte, actions []EditAction) ([]byte, error) {
+	docs, err := parseYAMLDocs(contents)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("empty file")
+	}
+	indent := yamlIndent(contents)
+	seqIndent := yamlSeqIndent(docs, indent)
+	for _, a := range actions {
+		path, err := parsePath(a.Path)
+		if err != nil {
+			return nil, err
+		}
+		for i := range docs {
+			// every edit moves the nodes after it, so locate them again
+			if docs, err = parseYAMLDocs(contents); err != nil {
+				return nil, err
+			}
+			e := &yamlEditor{text: newYAMLText(contents), indent: indent, seqIndent: seqIndent}
+			end := e.text.numLines()
+			if i+1 < len(docs) {
+				end = docs[i+1].Line - 1
+			}
+			if err := e.apply(docs[i], end, a.Op, path, parseValue(a.Value)); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", a.Op, a.Path, err)
+			}
+			contents = append(append(append([]byte{}, contents[:e.start]...), e.replace...), contents[e.end:]...)
+		}
+	}
+	return contents, nil
+}
+
+func parseYAMLDocs(contents []byte) ([]*yaml.Node, error) {
+	docs := []*yaml.Node{}
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	for {
+		var doc yaml.Node
+		if err := decoder.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				return docs, nil
+			}
+			return nil, err
+		}
+		docs = append(docs, &doc)
+	}
+}
+
+// yamlIndent guesses the indentation of a YAML file from its least indented nested line
+func yamlIndent(contents []byte) int {
+	indent := 0
+	for _, line := range strings.Split(string(contents), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if n := len(line) - len(trimmed); n > 0 && (indent == 0 || n < indent) {
+			indent = n
+		}
+	}
+	if indent < 2 {
+		return 2
+	}
+	return indent
+}
+
+// yamlSeqIndent returns how much sequences are indented under their key, e.g. 0 for `key:\n- a`
+func yamlSeqIndent(docs []*yaml.Node, indent int) int {
+	var walk func(node *yaml.Node) (int, bool)
+	walk = func(node *yaml.Node) (int, bool) {
+		for i, child := range node.Content {
+			if node.Kind == yaml.MappingNode && i%2 == 1 && isBlockCollection(child) && child.Kind == yaml.SequenceNode {
+				return child.Column - node.Content[i-1].Column, true
+			}
+			if n, ok := walk(child); ok {
+				return n, true
+			}
+		}
+		return 0, false
+	}
+	for _, doc := range docs {
+		if n, ok := walk(doc); ok {
+			return n
+		}
+	}
+	return indent
+}
+
+func (e *yamlEditor) edit(start, end int, text string) {
+	e.start, e.end, e.replace = start, end, text
+}
+
+func (e *yamlEditor) apply(doc *yaml.Node, endLine int, op string, path []pathElem, value *yaml.Node) error {
+	if len(doc.Content) == 0 {
+		return fmt.Errorf("%s not found", formatPath(path[:1]))
+	}
+	t := e.text
+	root := doc.Content[0]
+	parent := yamlEntry{node: root, dash: -1, startLine: root.Line, column: root.Column}
+	parent.endLine = t.trimEnd(root.Line, endLine, 1)
+
+	// walk down the block collections, to the parent of the edited node, or to a flow collection to rewrite whole
+	for i, elem := range path {
+		node := parent.node
+		if node.Kind == yaml.AliasNode {
+			return fmt.Errorf("%s is an alias, editing through aliases is unsupported", formatPath(path[:i]))
+		}
+		if isFlow(node) && (node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode) {
+			// the edit lands inside the flow collection, which is written again whole
+			if err := applyAction(root, op, path, value); err != nil {
+				return err
+			}
+			return e.rewrite(node)
+		}
+		if i == len(path)-1 {
+			break
+		}
+		j, ok := find(node, elem)
+		if !ok {
+			return fmt.Errorf("%s not found", formatPath(path[:i+1]))
+		}
+		parent = t.child(parent, j)
+	}
+
+	last := path[len(path)-1]
+	i, found := find(parent.node, last)
+	switch op {
+	case EditSet:
+		if found {
+			return e.replaceValue(t.child(parent, i), value)
+		}
+		if parent.node.Kind == yaml.MappingNode && !last.IsIndex {
+			return e.addKey(parent, last.Key, value)
+		}
+	case EditDelete:
+		if found {
+			return e.delete(parent, t.child(parent, i))
+		}
+	case EditAppend:
+		if found {
+			entry := t.child(parent, i)
+			list := entry.node
+			if list.Kind == yaml.AliasNode {
+				return fmt.Errorf("%s is an alias, editing through aliases is unsupported", formatPath(path))
+			}
+			if list.Kind != yaml.SequenceNode {
+				return fmt.Errorf("%s is not a list", formatPath(path))
+			}
+			if isFlow(list) {
+				list.Content = append(list.Content, value)
+				return e.rewrite(list)
+			}
+			return e.appendItem(entry, value)
+		}
+	}
+	return fmt.Errorf("%s not found", formatPath(path))
+}
+
+// rewrite replaces the text of a flow collection with the node
+func (e *yamlEditor) rewrite(node *yaml.Node) error {
+	node.Style |= yaml.FlowStyle
+	text, err := renderYAML(node, e.indent)
+	if err != nil {
+		return err
+	}
+	start := e.text.offset(node.Line, node.Column)
+	e.edit(start, e.text.flowEnd(start), indentContinuation(text, e.text.lineIndent(node.Line)+e.indent))
+	return nil
+}
+
+// lineIndent counts the spaces starting a line
+func (t *yamlText) lineIndent(n int) int {
+	line := t.line(n)
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// flowEnd returns the offset after the bracket closing the flow collection starting at start
+func (t *yamlText) flowEnd(start int) int {
+	depth := 0
+	for i := start; i < len(t.src); i++ {
+		switch t.src[i] {
+		case '"', '\'':
+			i = t.quoteEnd(i) - 1
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(t.src)
+}
+
+// quoteEnd returns the offset after the quote closing the string starting at start
+func (t *yamlText) quoteEnd(start int) int {
+	quote := t.src[start]
+	for i := start + 1; i < len(t.src); i++ {
+		switch {
+		case quote == '"' && t.src[i] == '\\':
+			i++
+		case t.src[i] == quote && quote == '\'' && i+1 < len(t.src) && t.src[i+1] == '\'':
+			i++
+		case t.src[i] == quote:
+			return i + 1
+		}
+	}
+	return len(t.src)
+}
+
+// scalarEnd returns the offset after a scalar, ending on or before the last line of its entry
+func (t *yamlText) scalarEnd(node *yaml.Node, endLine int) int {
+	start := t.offset(node.Line, node.Column)
+	switch {
+	case node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0:
+		return t.quoteEnd(start)
+	case node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+		return t.lineEnd(endLine)
+	}
+	// plain scalars end before a comment, and may continue on more indented lines
+	last := node.Line
+	for line := node.Line + 1; line <= endLine; line++ {
+		if trimmed := strings.TrimSpace(t.line(line)); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			last = line
+		}
+	}
+	if last > node.Line {
+		return t.lineEnd(last)
+	}
+	text := string(t.src[start:t.lineEnd(node.Line)])
+	if i := strings.Index(text, " #"); i != -1 {
+		text = text[:i]
+	}
+	return start + len(strings.TrimRight(text, " "))
+}
+
+// keyEnd returns the offset after the `:` following a key
+func (t *yamlText) keyEnd(key *yaml.Node) int {
+	start := t.offset(key.Line, key.Column)
+	i := start
+	if key.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+		i = t.quoteEnd(start)
+	}
+	for i < len(t.src) && !(t.src[i] == ':' && (i+1 == len(t.src) || t.src[i+1] == ' ' || t.src[i+1] == '\n')) {
+		i++
+	}
+	return i + 1
+}
+
+// valueEnd returns the offset after the text of an entry's value
+func (t *yamlText) valueEnd(entry yamlEntry) int {
+	node := entry.node
+	switch {
+	case isBlockCollection(node):
+		return t.lineEnd(entry.endLine)
+	case node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode:
+		return t.flowEnd(t.offset(node.Line, node.Column))
+	}
+	return t.scalarEnd(node, entry.endLine)
+}
+
+// valueText returns the text of value, to follow the `key:` or `-` of an entry at column
+func (e *yamlEditor) valueText(value *yaml.Node, column int, inMapping bool) (string, error) {
+	text, err := renderYAML(value, e.indent)
+	if err != nil {
+		return "", err
+	}
+	indent := column - 1
+	if !isBlockCollection(value) {
+		return " " + indentContinuation(text, indent), nil
+	}
+	if !inMapping {
+		// the collection starts on the line of the `-`
+		return " " + indentContinuation(text, indent+2), nil
+	}
+	if value.Kind == yaml.SequenceNode {
+		indent += e.seqIndent
+	} else {
+		indent += e.indent
+	}
+	return "\n" + strings.Repeat(" ", indent) + indentContinuation(text, indent), nil
+}
+
+func (e *yamlEditor) replaceValue(entry yamlEntry, value *yaml.Node) error {
+	t := e.text
+	old := entry.node
+	if old.Kind == yaml.ScalarNode && value.Kind == yaml.ScalarNode && old.ShortTag() == "!!str" && value.ShortTag() == "!!str" {
+		// keep the quoting of strings, and block scalars for text that still has several lines
+		if old.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 || strings.Contains(value.Value, "\n") {
+			value.Style = old.Style
+		}
+	}
+	start := t.offset(old.Line, old.Column)
+	switch {
+	case entry.key != nil && isBlockCollection(old) && isBlockCollection(value):
+		// keep the key's line, and its comment
+		start = t.lineEnd(entry.key.Line)
+	case entry.key != nil:
+		start = t.keyEnd(entry.key)
+	case entry.dash != -1:
+		start = entry.dash + 1
+	}
+	end := t.valueEnd(entry)
+	if isEmpty(old) {
+		// `key:` with no value
+		end = start
+	}
+	text, err := e.valueText(value, entry.column, entry.key != nil)
+	if err != nil {
+		return err
+	}
+	if entry.isRoot() {
+		text = strings.TrimPrefix(strings.TrimPrefix(text, " "), "\n")
+	}
+	e.edit(start, end, text)
+	return nil
+}
+
+func (e *yamlEditor) addKey(parent yamlEntry, key string, value *yaml.Node) error {
+	entries := e.text.entries(parent)
+	last := entries[len(entries)-1]
+	keyText, err := renderYAML(&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, e.indent)
+	if err != nil {
+		return err
+	}
+	text, err := e.valueText(value, last.column, true)
+	if err != nil {
+		return err
+	}
+	at := e.text.lineEnd(last.endLine)
+	e.edit(at, at, "\n"+strings.Repeat(" ", last.column-1)+keyText+":"+text)
+	return nil
+}
+
+func (e *yamlEditor) appendItem(list yamlEntry, value *yaml.Node) error {
+	items := e.text.entries(list)
+	last := items[len(items)-1]
+	text, err := e.valueText(value, last.column, false)
+	if err != nil {
+		return err
+	}
+	at := e.text.lineEnd(last.endLine)
+	e.edit(at, at, "\n"+strings.Repeat(" ", last.column-1)+"-"+text)
+	return nil
+}
+
+func (e *yamlEditor) delete(parent yamlEntry, entry yamlEntry) error {
+	t := e.text
+	entries := t.entries(parent)
+	if len(entries) == 1 {
+		empty := &yaml.Node{Kind: parent.node.Kind, Style: yaml.FlowStyle}
+		return e.replaceValue(parent, empty)
+	}
+	if !t.atLineStart(entry.startLine, entry.column) {
+		// the first key of a mapping starting on the line of its `-`: the next key takes its place
+		for i, other := range entries {
+			if other.node == entry.node {
+				next := entries[i+1]
+				e.edit(t.offset(entry.startLine, entry.column), t.offset(next.startLine, next.column), "")
+				return nil
+			}
+		}
+	}
+	start, end := t.lines[entry.startLine-1], t.lineEnd(entry.endLine)+1
+	if end > len(t.src) {
+		// the last line has no newline: remove the one before it instead
+		start, end = start-1, end-1
+	}
+	e.edit(start, end, "")
+	return nil
+}
+
+// renderYAML formats a node, without a trailing newline
+func renderYAML(node *yaml.Node, indent int) (string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(indent)
+	if err := encoder.Encode(node); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// indentContinuation indents all lines but the first by n spaces
+func indentContinuation(text string, n int) string {
+	lines := strings.Split(text, "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = strings.Repeat(" ", n) + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
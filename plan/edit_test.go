@@ -0,0 +1,235 @@
+package plan
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditYAML(t *testing.T) {
+	edited, err := editYAML([]byte(`# launch config
+team: eng-apps # owner
+
+env:
+- name: A
+  value: "1"   # first
+
+- name: C
+  value: c
+expose: []
+resources: {cpu: 1, memory: 512}
+run: |
+  ./app
+  --flag
+`), []EditAction{
+		{Op: EditSet, Path: "team", Value: "eng-infra"},
+		{Op: EditSet, Path: "env[0].value", Value: "2"},
+		{Op: EditAppend, Path: "env", Value: "{name: B, value: b}"},
+		{Op: EditDelete, Path: "env[1]"},
+		{Op: EditDelete, Path: "expose"},
+		{Op: EditSet, Path: "resources.cpu", Value: "2"},
+		{Op: EditSet, Path: "run", Value: "./app2"},
+		{Op: EditSet, Path: "new", Value: "true"},
+	})
+	require.NoError(t, err)
+	// everything but the edited values is left alone
+	assert.Equal(t, `# launch config
+team: eng-infra # owner
+
+env:
+- name: A
+  value: 2   # first
+
+- {name: B, value: b}
+resources: {cpu: 2, memory: 512}
+run: ./app2
+new: true
+`, string(edited))
+
+	edited, err = editYAML([]byte(`a:
+    b: 1
+
+    c:
+        - x
+---
+a:
+    b: 2
+    c: []
+`), []EditAction{
+		{Op: EditSet, Path: "a.d", Value: "{e: 1}"},
+		{Op: EditAppend, Path: "a.c", Value: "y"},
+		{Op: EditSet, Path: "a.g", Value: "- 1\n- 2"},
+		{Op: EditDelete, Path: "a.b"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `a:
+
+    c:
+        - x
+        - y
+    d: {e: 1}
+    g:
+        - 1
+        - 2
+---
+a:
+    c: [y]
+    d: {e: 1}
+    g:
+        - 1
+        - 2
+`, string(edited))
+
+	_, err = editYAML([]byte("a: 1\n"), []EditAction{{Op: EditSet, Path: "b.c", Value: "1"}})
+	assert.EqualError(t, err, "set b.c: b not found")
+	_, err = editYAML([]byte("a: 1\n"), []EditAction{{Op: EditDelete, Path: "b"}})
+	assert.EqualError(t, err, "delete b: b not found")
+	_, err = editYAML([]byte("a: 1\n"), []EditAction{{Op: EditAppend, Path: "a", Value: "1"}})
+	assert.EqualError(t, err, "append a: a is not a list")
+}
+
+func TestEditJSON(t *testing.T) {
+	edited, err := editJSON([]byte(`{
+    "name": "app",
+    "engines": {"node": ">=16", "npm": "8"},
+    "files": ["<dist>"],
+    "scripts": {
+        "test": "jest",
+        "lint": "eslint"
+    },
+    "keywords": []
+}
+`), []EditAction{
+		{Op: EditSet, Path: "engines.node", Value: ">=20"},
+		{Op: EditDelete, Path: "engines.npm"},
+		{Op: EditAppend, Path: "files", Value: "lib"},
+		{Op: EditDelete, Path: "scripts.lint"},
+		{Op: EditSet, Path: "scripts.build", Value: "tsc"},
+		{Op: EditAppend, Path: "keywords", Value: "cli"},
+		{Op: EditSet, Path: "private", Value: "true"},
+		{Op: EditSet, Path: "size", Value: "0x10"},
+		{Op: EditSet, Path: "repository", Value: "{type: git, url: x}"},
+	})
+	require.NoError(t, err)
+	// untouched lines, and the layout of objects and arrays, are left alone
+	assert.Equal(t, `{
+    "name": "app",
+    "engines": {"node": ">=20"},
+    "files": ["<dist>", "lib"],
+    "scripts": {
+        "test": "jest",
+        "build": "tsc"
+    },
+    "keywords": [
+        "cli"
+    ],
+    "private": true,
+    "size": 16,
+    "repository": {
+        "type": "git",
+        "url": "x"
+    }
+}
+`, string(edited))
+
+	_, err = editJSON([]byte(`{"a": 1}`), []EditAction{{Op: EditSet, Path: "a", Value: ".inf"}})
+	assert.EqualError(t, err, "set a: .inf can't be written as JSON")
+	_, err = editJSON([]byte(`{"a": 1,}`), []EditAction{{Op: EditSet, Path: "a", Value: "2"}})
+	assert.EqualError(t, err, "invalid JSON")
+}
+
+func TestEditTOML(t *testing.T) {
+	edited, err := editTOML([]byte(`# project
+name = "app" # the name
+
+[tool.ruff]
+line-length = 88
+select = ["E", "F"] # rules
+extend = [
+  "a",
+  "b"  # last
+]
+
+[[bin]]
+name = "x"
+`), []EditAction{
+		{Op: EditSet, Path: "name", Value: "app2"},
+		{Op: EditSet, Path: "tool.ruff.line-length", Value: "100"},
+		{Op: EditAppend, Path: "tool.ruff.select", Value: "I"},
+		{Op: EditAppend, Path: "tool.ruff.extend", Value: "c"},
+		{Op: EditSet, Path: "tool.ruff.fix", Value: "true"},
+		{Op: EditDelete, Path: "name"},
+		{Op: EditSet, Path: "version", Value: "1.0.0"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `# project
+version = "1.0.0"
+
+[tool.ruff]
+line-length = 100
+select = ["E", "F", "I"] # rules
+extend = [
+  "a",
+  "b",  # last
+  "c",
+]
+fix = true
+
+[[bin]]
+name = "x"
+`, string(edited))
+
+	edited, err = editTOML([]byte(`t.x.y = 1
+
+[tool]
+ruff.line-length = 88
+`), []EditAction{
+		{Op: EditSet, Path: "t.x.z", Value: "2"},
+		{Op: EditSet, Path: "tool.ruff.fix", Value: "True"},
+		{Op: EditSet, Path: "tool.size", Value: "0x10"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `t.x.y = 1
+t.x.z = 2
+
+[tool]
+ruff.line-length = 88
+ruff.fix = true
+size = 16
+`, string(edited))
+
+	_, err = editTOML([]byte("a = { b = 1 }\n"), []EditAction{{Op: EditSet, Path: "a.b", Value: "2"}})
+	assert.EqualError(t, err, "set a.b: a is an inline table, editing inside inline tables is unsupported")
+	_, err = editTOML([]byte("a = 1\n"), []EditAction{{Op: EditSet, Path: "a.b", Value: "2"}})
+	assert.EqualError(t, err, "set a.b: a is not a table")
+	_, err = editTOML([]byte("[[bin]]\nname = \"x\"\n"), []EditAction{{Op: EditSet, Path: "bin.name", Value: "y"}})
+	assert.EqualError(t, err, "set bin.name: bin is an array of tables, editing arrays of tables is unsupported")
+	_, err = editTOML([]byte("[a.b]\nc = 1\n"), []EditAction{{Op: EditSet, Path: "a.d", Value: "1"}})
+	assert.EqualError(t, err, "set a.d: a is only defined by the header of [a.b], adding keys to it is unsupported")
+	_, err = editTOML([]byte("t.x.y = 1\n"), []EditAction{{Op: EditSet, Path: "t.x", Value: "1"}})
+	assert.EqualError(t, err, "set t.x: t.x is a table, only keys can be edited")
+	_, err = editTOML([]byte("[a]\nb = 1\n"), []EditAction{{Op: EditSet, Path: "x.y", Value: "1"}})
+	assert.EqualError(t, err, "set x.y: x not found")
+	_, err = editTOML([]byte("[a]\nb = 1\n"), []EditAction{{Op: EditSet, Path: "a", Value: "1"}})
+	assert.EqualError(t, err, "set a: a is a table, only keys can be edited")
+}
+
+func TestEditApply(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"launch/a.yml": "team: a\n", "launch/b.yml": "team: b\n"})
+
+	op, err := NewEdit([]string{"launch/*.yml"}, []EditAction{{Op: EditSet, Path: "team", Value: "c"}})
+	require.NoError(t, err)
+	output := Output{}
+	require.NoError(t, op.Apply(context.Background(), dir, Context{}, &output))
+	assert.Equal(t, map[string]int{"launch/a.yml": 1, "launch/b.yml": 1}, output.Edits)
+	assert.Equal(t, "team: c\n", readFile(t, filepath.Join(dir, "launch/b.yml")))
+
+	_, err = NewEdit([]string{"*.yml"}, []EditAction{{Op: "rename", Path: "a"}})
+	assert.Error(t, err)
+	_, err = NewEdit([]string{"*.yml"}, []EditAction{{Op: EditSet, Path: "a..b", Value: "1"}})
+	assert.Error(t, err)
+}
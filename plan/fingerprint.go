@@ -0,0 +1,102 @@
+package plan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Clever/microplane/git"
+)
+
+// fileOperation is an Operation reading its change from files, whose contents are part of the plan's fingerprint.
+// The first file is the one the Operation was made with, e.g. a Starlark script, followed by the ones it refers to.
+type fileOperation interface {
+	files() ([]string, error)
+}
+
+func (p *Patch) files() ([]string, error) { return []string{p.Path}, nil }
+
+// fingerprintStep is what identifies a Step in a fingerprint
+type fingerprintStep struct {
+	Command       Command
+	OperationType string    `json:",omitempty"`
+	Operation     Operation `json:",omitempty"`
+	FileSHAs      []string  `json:",omitempty"`
+	// CommandFileSHAs of the command's path and args that are files, e.g. the script being iterated on
+	CommandFileSHAs []string `json:",omitempty"`
+	Message         string
+}
+
+func fileSHA(path string) (string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// fingerprint identifies everything that determines the planned change: the base commit, the change itself,
+// and how it's committed and validated. A plan with the same fingerprint as a successful one would make the same change.
+func (input Input) fingerprint(baseSHA string) (string, error) {
+	steps := input.Steps
+	if len(steps) == 0 {
+		steps = []Step{{Command: input.Command, Operation: input.Operation}}
+	}
+	fpSteps := []fingerprintStep{}
+	for _, step := range steps {
+		fpStep := fingerprintStep{Command: step.Command, Message: step.Message}
+		if step.Operation != nil {
+			fpStep.OperationType = fmt.Sprintf("%T", step.Operation)
+			fpStep.Operation = step.Operation
+		}
+		if op, ok := step.Operation.(fileOperation); ok {
+			files, err := op.files()
+			if err != nil {
+				return "", err
+			}
+			for _, file := range files {
+				sha, err := fileSHA(file)
+				if err != nil {
+					return "", err
+				}
+				fpStep.FileSHAs = append(fpStep.FileSHAs, sha)
+			}
+		}
+		for _, arg := range append([]string{step.Command.Path}, step.Command.Args...) {
+			if info, err := os.Stat(arg); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			sha, err := fileSHA(arg)
+			if err != nil {
+				return "", err
+			}
+			fpStep.CommandFileSHAs = append(fpStep.CommandFileSHAs, sha)
+		}
+		fpSteps = append(fpSteps, fpStep)
+	}
+
+	b, err := json.Marshal(struct {
+		BaseSHA          string
+		Steps            []fingerprintStep
+		Validate         []string
+		CommitMessage    string
+		BranchName       string
+		Campaign         string
+		Vars             map[string]string
+		AllowEmptyCommit bool
+		Author           git.Identity
+		Committer        git.Identity
+		Signoff          bool
+		Trailers         []string
+		Signing          git.Signing
+	}{baseSHA, fpSteps, input.Validate, input.CommitMessage, input.BranchName, input.Campaign, input.Vars, input.AllowEmptyCommit,
+		input.Author, input.Committer, input.Signoff, input.Trailers, input.Signing})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
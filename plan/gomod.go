@@ -0,0 +1,131 @@
+package plan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// GoModChange is a dependency whose version was changed by the GoMod operation
+type GoModChange struct {
+	Module     string
+	OldVersion string
+	NewVersion string
+}
+
+// GoMod is an Operation bumping dependencies in the repo's go.mod.
+// Repos that don't depend on any of the modules, or already require the versions or newer, are skipped.
+type GoMod struct {
+	Require []module.Version
+	// Tidy runs `go mod tidy` after editing go.mod
+	Tidy bool
+}
+
+// NewGoMod parses the requirements, given as `module@version`
+func NewGoMod(requires []string, tidy bool) (*GoMod, error) {
+	if len(requires) == 0 {
+		return nil, fmt.Errorf("no modules to require")
+	}
+	op := &GoMod{Tidy: tidy}
+	for _, r := range requires {
+		parts := strings.SplitN(r, "@", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid requirement '%s', expected 'module@version'", r)
+		}
+		mod := module.Version{Path: parts[0], Version: parts[1]}
+		if err := module.Check(mod.Path, mod.Version); err != nil {
+			return nil, err
+		}
+		op.Require = append(op.Require, mod)
+	}
+	return op, nil
+}
+
+// Apply bumps the required modules that the repo depends on, recording them in output.GoModChanges
+func (g *GoMod) Apply(ctx context.Context, dir string, changeCtx Context, output *Output) error {
+	path := filepath.Join(dir, "go.mod")
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		output.SkipReason = "no go.mod"
+		return nil
+	} else if err != nil {
+		return err
+	}
+	f, err := modfile.Parse(path, contents, nil)
+	if err != nil {
+		return err
+	}
+
+	changes := []GoModChange{}
+	dependsOn := false
+	for _, mod := range g.Require {
+		old := ""
+		for _, r := range f.Require {
+			if r.Mod.Path == mod.Path {
+				old = r.Mod.Version
+			}
+		}
+		if old == "" {
+			continue
+		}
+		dependsOn = true
+		if semver.Compare(old, mod.Version) >= 0 {
+			continue
+		}
+		if err := f.AddRequire(mod.Path, mod.Version); err != nil {
+			return err
+		}
+		changes = append(changes, GoModChange{Module: mod.Path, OldVersion: old, NewVersion: mod.Version})
+	}
+	if !dependsOn {
+		output.SkipReason = fmt.Sprintf("doesn't depend on %s", g.modules())
+		return nil
+	}
+	if len(changes) == 0 {
+		output.SkipReason = fmt.Sprintf("already requires %s or newer", g.versions())
+		return nil
+	}
+
+	f.Cleanup()
+	edited, err := f.Format()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, edited, 0644); err != nil {
+		return err
+	}
+	output.GoModChanges = append(output.GoModChanges, changes...)
+
+	if g.Tidy {
+		cmd := exec.CommandContext(ctx, "go", "mod", "tidy")
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("go mod tidy: %s: %s", err, out)
+		}
+	}
+	return nil
+}
+
+func (g *GoMod) versions() string {
+	mods := []string{}
+	for _, mod := range g.Require {
+		mods = append(mods, mod.String())
+	}
+	return strings.Join(mods, ", ")
+}
+
+func (g *GoMod) modules() string {
+	mods := []string{}
+	for _, mod := range g.Require {
+		mods = append(mods, mod.Path)
+	}
+	return strings.Join(mods, ", ")
+}
@@ -0,0 +1,62 @@
+package plan
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testGoMod = `module example.com/app
+
+go 1.22
+
+require (
+	github.com/a/b v1.2.0 // pinned
+	golang.org/x/net v0.20.0 // indirect
+)
+`
+
+func TestGoMod(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"go.mod": testGoMod})
+
+	op, err := NewGoMod([]string{"github.com/a/b@v1.3.0", "golang.org/x/net@v0.19.0", "github.com/c/d@v1.0.0"}, false)
+	require.NoError(t, err)
+	output := Output{}
+	require.NoError(t, op.Apply(context.Background(), dir, Context{}, &output))
+
+	assert.Empty(t, output.SkipReason)
+	assert.Equal(t, []GoModChange{{Module: "github.com/a/b", OldVersion: "v1.2.0", NewVersion: "v1.3.0"}}, output.GoModChanges)
+	assert.Contains(t, readFile(t, filepath.Join(dir, "go.mod")), "\tgithub.com/a/b v1.3.0 // pinned\n")
+	assert.Contains(t, readFile(t, filepath.Join(dir, "go.mod")), "\tgolang.org/x/net v0.20.0 // indirect\n")
+}
+
+func TestGoModSkip(t *testing.T) {
+	dir := t.TempDir()
+	op, err := NewGoMod([]string{"github.com/c/d@v1.0.0"}, false)
+	require.NoError(t, err)
+
+	output := Output{}
+	require.NoError(t, op.Apply(context.Background(), dir, Context{}, &output))
+	assert.Equal(t, "no go.mod", output.SkipReason)
+
+	writeFiles(t, dir, map[string]string{"go.mod": testGoMod})
+	output = Output{}
+	require.NoError(t, op.Apply(context.Background(), dir, Context{}, &output))
+	assert.Equal(t, "doesn't depend on github.com/c/d", output.SkipReason)
+
+	op, err = NewGoMod([]string{"github.com/a/b@v1.1.0"}, false)
+	require.NoError(t, err)
+	output = Output{}
+	require.NoError(t, op.Apply(context.Background(), dir, Context{}, &output))
+	assert.Equal(t, "already requires github.com/a/b@v1.1.0 or newer", output.SkipReason)
+	assert.Equal(t, testGoMod, readFile(t, filepath.Join(dir, "go.mod")))
+
+	_, err = NewGoMod([]string{"github.com/a/b"}, false)
+	assert.Error(t, err)
+	_, err = NewGoMod([]string{"github.com/a/b@latest"}, false)
+	assert.Error(t, err)
+}
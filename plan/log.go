@@ -0,0 +1,123 @@
+package plan
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxLogBytes bounds the size of each of the change command's log files
+const MaxLogBytes = 1024 * 1024
+
+// StdoutLog and StderrLog are the files in WorkDir the change command's output is saved to
+const (
+	StdoutLog = "stdout.log"
+	StderrLog = "stderr.log"
+)
+
+// logWriter appends to a log file, prefixing every line with a timestamp.
+// Once the file reaches MaxLogBytes, the rest of the output is dropped.
+type logWriter struct {
+	mu        sync.Mutex
+	f         *os.File
+	size      int64
+	lineStart bool
+	truncated bool
+	now       func() time.Time
+}
+
+// openLog opens a log file in workDir for appending
+func openLog(workDir, name string) (*logWriter, error) {
+	f, err := os.OpenFile(filepath.Join(workDir, name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &logWriter{f: f, size: info.Size(), lineStart: true, truncated: info.Size() >= MaxLogBytes, now: time.Now}, nil
+}
+
+// clearLogs removes the logs of a previous plan
+func clearLogs(workDir string) error {
+	for _, name := range []string{StdoutLog, StderrLog} {
+		if err := os.Remove(filepath.Join(workDir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write never fails, so that a full disk doesn't fail the command whose output is logged
+func (l *logWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.truncated {
+		return len(p), nil
+	}
+
+	var buf bytes.Buffer
+	for rest := p; len(rest) > 0; {
+		if l.lineStart {
+			buf.WriteString(l.now().UTC().Format(time.RFC3339) + " ")
+			l.lineStart = false
+		}
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			buf.Write(rest)
+			break
+		}
+		buf.Write(rest[:i+1])
+		rest = rest[i+1:]
+		l.lineStart = true
+	}
+
+	out := buf.Bytes()
+	if l.size+int64(len(out)) > MaxLogBytes {
+		out = append(out[:max(MaxLogBytes-l.size, 0)], fmt.Sprintf("\n[truncated at %d bytes]\n", MaxLogBytes)...)
+		l.truncated = true
+	}
+	n, _ := l.f.Write(out)
+	l.size += int64(n)
+	return len(p), nil
+}
+
+// header logs a line marking the start of a command's output
+func (l *logWriter) header(cmd Command) {
+	l.mu.Lock()
+	if !l.lineStart {
+		l.f.Write([]byte("\n"))
+		l.size++
+		l.lineStart = true
+	}
+	l.mu.Unlock()
+	fmt.Fprintf(l, "$ %s\n", strings.Join(append([]string{cmd.Path}, cmd.Args...), " "))
+}
+
+func (l *logWriter) Close() error {
+	return l.f.Close()
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent writes of stdout and stderr
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
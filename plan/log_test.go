@@ -0,0 +1,57 @@
+package plan
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogWriter(t *testing.T) {
+	dir := t.TempDir()
+	l, err := openLog(dir, StdoutLog)
+	require.NoError(t, err)
+	l.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	l.header(Command{Path: "echo", Args: []string{"hi"}})
+	fmt.Fprint(l, "hi\npart")
+	fmt.Fprint(l, "ial\n")
+	fmt.Fprint(l, "no newline")
+	l.header(Command{Path: "true"})
+	require.NoError(t, l.Close())
+
+	assert.Equal(t, `2024-01-02T03:04:05Z $ echo hi
+2024-01-02T03:04:05Z hi
+2024-01-02T03:04:05Z partial
+2024-01-02T03:04:05Z no newline
+2024-01-02T03:04:05Z $ true
+`, readFile(t, filepath.Join(dir, StdoutLog)))
+}
+
+func TestLogWriterTruncates(t *testing.T) {
+	dir := t.TempDir()
+	l, err := openLog(dir, StderrLog)
+	require.NoError(t, err)
+	line := strings.Repeat("x", 1023) + "\n"
+	for i := 0; i < 2*MaxLogBytes/len(line); i++ {
+		n, err := l.Write([]byte(line))
+		require.NoError(t, err)
+		require.Equal(t, len(line), n)
+	}
+	require.NoError(t, l.Close())
+
+	contents := readFile(t, filepath.Join(dir, StderrLog))
+	assert.LessOrEqual(t, len(contents), MaxLogBytes+100)
+	assert.True(t, strings.HasSuffix(contents, fmt.Sprintf("[truncated at %d bytes]\n", MaxLogBytes)))
+
+	// appending to a full log drops the output
+	l, err = openLog(dir, StderrLog)
+	require.NoError(t, err)
+	l.Write([]byte("more\n"))
+	require.NoError(t, l.Close())
+	assert.Equal(t, contents, readFile(t, filepath.Join(dir, StderrLog)))
+}
@@ -0,0 +1,124 @@
+package plan
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Results of the Patch operation
+const (
+	// PatchApplied means the patch applied cleanly
+	PatchApplied = "applied"
+	// PatchConflict means a 3-way merge of the patch left conflict markers in Output.PatchFiles
+	PatchConflict = "conflict"
+	// PatchRejected means hunks of the patch didn't apply, and were saved next to Output.PatchFiles as .rej files
+	PatchRejected = "rejected"
+)
+
+// Patch is an Operation applying a patch made in another repo.
+// Patches produced by `git format-patch` are applied with `git am`, keeping their commits, and others with `git apply`.
+// Plan makes the commits again with its committer, trailers and signing, keeping their messages and, without
+// Input.Author, their authors.
+// If the patch doesn't apply cleanly, the conflicts or rejected hunks are left in the worktree for inspection,
+// and a failed `git am` is ended with `git am --quit`, which keeps them.
+type Patch struct {
+	// Path of the patch
+	Path string
+	// AM is whether the patch is an mbox to apply with `git am`
+	AM bool
+}
+
+// NewPatch reads the patch to tell how to apply it
+func NewPatch(path string) (*Patch, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(contents)) == 0 {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Patch{Path: abs, AM: bytes.HasPrefix(contents, []byte("From "))}, nil
+}
+
+// Apply applies the patch in dir, recording the result in output.PatchResult
+func (p *Patch) Apply(ctx context.Context, dir string, changeCtx Context, output *Output) (retErr error) {
+	var applyErr error
+	if p.AM {
+		_, applyErr = runGit(ctx, dir, "am", "--3way", p.Path)
+	} else {
+		_, applyErr = runGit(ctx, dir, "apply", "--3way", p.Path)
+	}
+	if applyErr == nil {
+		// commits made by `git am` are made again by Plan, with its identity, trailers and signing
+		output.PatchResult = PatchApplied
+		return nil
+	}
+
+	conflicts, err := runGit(ctx, dir, "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return err
+	}
+	if p.AM {
+		// end the failed `git am` session once its patch is applied with rejects, keeping the worktree
+		defer func() {
+			if _, err := runGit(context.WithoutCancel(ctx), dir, "am", "--quit"); err != nil && retErr == nil {
+				retErr = err
+			}
+		}()
+	}
+	if files := strings.Fields(conflicts); len(files) > 0 {
+		output.PatchResult = PatchConflict
+		output.PatchFiles = files
+		return fmt.Errorf("patch conflicts in %s, kept with conflict markers in %s: %w", strings.Join(files, ", "), dir, applyErr)
+	}
+
+	// apply the hunks that can be, saving the others as .rej files
+	patchPath := p.Path
+	if p.AM {
+		gitPath, err := runGit(ctx, dir, "rev-parse", "--git-path", "rebase-apply/patch")
+		if err != nil {
+			return err
+		}
+		patchPath = strings.TrimSpace(gitPath)
+		if !filepath.IsAbs(patchPath) {
+			patchPath = filepath.Join(dir, patchPath)
+		}
+	}
+	// rejecting hunks fails too, which only matters if none were saved
+	_, rejectErr := runGit(ctx, dir, "apply", "--reject", patchPath)
+	rejected, err := matchFiles(dir, []string{"**/*.rej"})
+	if err != nil {
+		return err
+	}
+	if len(rejected) == 0 {
+		if rejectErr != nil {
+			return fmt.Errorf("patch doesn't apply: %w, %w", applyErr, rejectErr)
+		}
+		return fmt.Errorf("patch doesn't apply: %w", applyErr)
+	}
+	output.PatchResult = PatchRejected
+	for _, r := range rejected {
+		output.PatchFiles = append(output.PatchFiles, strings.TrimSuffix(r, ".rej"))
+	}
+	return fmt.Errorf("patch rejected in %s, kept as .rej files in %s: %w", strings.Join(output.PatchFiles, ", "), dir, applyErr)
+}
+
+// runGit runs the git binary in dir, for what the git package doesn't abstract
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("git %s: %s: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
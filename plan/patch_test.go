@@ -0,0 +1,197 @@
+package plan
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Clever/microplane/git"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makePatch commits files in a new clone, and returns the commit as a patch: an mbox, or a plain diff
+func makePatch(t *testing.T, files map[string]string, mbox bool) string {
+	g := &git.Exec{}
+	dir := cloneTestRepo(t, g)
+	writeFiles(t, dir, files)
+	ctx := context.Background()
+	require.NoError(t, g.AddAll(ctx, dir))
+	require.NoError(t, g.Commit(ctx, dir, "Change files", git.CommitOptions{}))
+	args := []string{"diff", "HEAD^", "HEAD"}
+	if mbox {
+		args = []string{"format-patch", "--stdout", "HEAD^"}
+	}
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "change.patch")
+	require.NoError(t, os.WriteFile(path, out, 0644))
+	return path
+}
+
+func TestPatch(t *testing.T) {
+	ctx := context.Background()
+	g := &git.Exec{}
+	for _, mbox := range []bool{true, false} {
+		patch, err := NewPatch(makePatch(t, map[string]string{"a.txt": "a\n"}, mbox))
+		require.NoError(t, err)
+		assert.Equal(t, mbox, patch.AM)
+
+		output, err := Plan(ctx, Input{
+			RepoDir:       cloneTestRepo(t, g),
+			WorkDir:       t.TempDir(),
+			Operation:     patch,
+			CommitMessage: "Apply patch",
+			BranchName:    "patch",
+			Git:           g,
+		})
+		require.NoError(t, err)
+		assert.True(t, output.Success)
+		assert.Equal(t, PatchApplied, output.PatchResult)
+		assert.Equal(t, "a\n", readFile(t, filepath.Join(output.PlanDir, "a.txt")))
+		require.Len(t, output.Commits, 1)
+		if mbox {
+			assert.Equal(t, "Change files", output.Commits[0].Message)
+		} else {
+			assert.Equal(t, "Apply patch", output.Commits[0].Message)
+		}
+	}
+}
+
+func TestPatchRejected(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "one\ntwo\n", "b.txt": "b\n"})
+	for _, args := range [][]string{{"init"}, {"add", "."}} {
+		require.NoError(t, exec.Command("git", append([]string{"-C", dir}, args...)...).Run())
+	}
+	patchPath := filepath.Join(t.TempDir(), "change.patch")
+	require.NoError(t, os.WriteFile(patchPath, []byte(`diff --git a/a.txt b/a.txt
+--- a/a.txt
++++ b/a.txt
+@@ -1,2 +1,2 @@
+-uno
++one!
+ two
+diff --git a/b.txt b/b.txt
+--- a/b.txt
++++ b/b.txt
+@@ -1 +1 @@
+-b
++bee
+`), 0644))
+
+	patch, err := NewPatch(patchPath)
+	require.NoError(t, err)
+	output := Output{}
+	err = patch.Apply(context.Background(), dir, Context{}, &output)
+	assert.ErrorContains(t, err, "patch rejected in a.txt")
+	assert.Equal(t, PatchRejected, output.PatchResult)
+	assert.Equal(t, []string{"a.txt"}, output.PatchFiles)
+	assert.Equal(t, "bee\n", readFile(t, filepath.Join(dir, "b.txt")))
+	assert.Contains(t, readFile(t, filepath.Join(dir, "a.txt.rej")), "+one!")
+}
+
+func TestPatchConflict(t *testing.T) {
+	dir := cloneTestRepo(t, &git.Exec{})
+	gitRun := func(args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+		return string(out)
+	}
+	writeFiles(t, dir, map[string]string{"a.txt": "x\n"})
+	gitRun("add", ".")
+	gitRun("commit", "-m", "x")
+	writeFiles(t, dir, map[string]string{"a.txt": "y\n"})
+	patchPath := filepath.Join(t.TempDir(), "change.patch")
+	require.NoError(t, os.WriteFile(patchPath, []byte(gitRun("diff")), 0644))
+	writeFiles(t, dir, map[string]string{"a.txt": "z\n"})
+	gitRun("commit", "-am", "z")
+
+	patch, err := NewPatch(patchPath)
+	require.NoError(t, err)
+	output := Output{}
+	err = patch.Apply(context.Background(), dir, Context{}, &output)
+	assert.ErrorContains(t, err, "patch conflicts in a.txt")
+	assert.Equal(t, PatchConflict, output.PatchResult)
+	assert.Equal(t, []string{"a.txt"}, output.PatchFiles)
+	assert.Contains(t, readFile(t, filepath.Join(dir, "a.txt")), "<<<<<<<")
+}
+
+func TestPatchAMRejected(t *testing.T) {
+	dir := cloneTestRepo(t, &git.Exec{})
+	gitRun := func(args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+		return string(out)
+	}
+	writeFiles(t, dir, map[string]string{"a.txt": "one\ntwo\n", "b.txt": "b\n"})
+	gitRun("add", ".")
+	gitRun("commit", "-m", "a and b")
+	patchPath := filepath.Join(t.TempDir(), "change.patch")
+	require.NoError(t, os.WriteFile(patchPath, []byte(`From 0000000000000000000000000000000000000000 Mon Sep 17 00:00:00 2001
+From: A U Thor <author@example.com>
+Date: Mon, 1 Jan 2024 00:00:00 +0000
+Subject: [PATCH] Change files
+
+---
+diff --git a/a.txt b/a.txt
+--- a/a.txt
++++ b/a.txt
+@@ -1,2 +1,2 @@
+-uno
++one!
+ two
+diff --git a/b.txt b/b.txt
+--- a/b.txt
++++ b/b.txt
+@@ -1 +1 @@
+-b
++bee
+`), 0644))
+
+	patch, err := NewPatch(patchPath)
+	require.NoError(t, err)
+	require.True(t, patch.AM)
+	output := Output{}
+	err = patch.Apply(context.Background(), dir, Context{}, &output)
+	assert.ErrorContains(t, err, "patch rejected in a.txt")
+	assert.Equal(t, PatchRejected, output.PatchResult)
+	assert.Equal(t, "bee\n", readFile(t, filepath.Join(dir, "b.txt")))
+	assert.Contains(t, readFile(t, filepath.Join(dir, "a.txt.rej")), "+one!")
+	// the failed am session is over
+	_, err = os.Stat(filepath.Join(dir, strings.TrimSpace(gitRun("rev-parse", "--git-path", "rebase-apply"))))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPatchAMIdentity(t *testing.T) {
+	g := &git.Exec{}
+	patch, err := NewPatch(makePatch(t, map[string]string{"a.txt": "a\n"}, true))
+	require.NoError(t, err)
+	output, err := Plan(context.Background(), Input{
+		RepoDir:       cloneTestRepo(t, g),
+		WorkDir:       t.TempDir(),
+		Operation:     patch,
+		CommitMessage: "Apply patch",
+		BranchName:    "patch",
+		Author:        git.Identity{Name: "Jane Doe", Email: "jane@example.com"},
+		Committer:     git.Identity{Name: "Bot", Email: "bot@example.com"},
+		Signoff:       true,
+		Trailers:      []string{"Ticket: ABC-1"},
+		Git:           g,
+	})
+	require.NoError(t, err)
+	require.True(t, output.Success)
+
+	// the patch's commit is made again as the plan's own
+	require.Len(t, output.Commits, 1)
+	commit := output.Commits[0]
+	assert.Equal(t, "Change files\n\nTicket: ABC-1", commit.Message)
+	assert.Equal(t, "none", commit.Signature)
+	out, err := exec.Command("git", "-C", output.PlanDir, "log", "-1", "--format=%an <%ae>|%cn <%ce>|%B", commit.SHA).Output()
+	require.NoError(t, err)
+	assert.Equal(t, "Jane Doe <jane@example.com>|Bot <bot@example.com>|Change files\n\nTicket: ABC-1\nSigned-off-by: Bot <bot@example.com>", strings.TrimSpace(string(out)))
+	assert.Equal(t, "a\n", readFile(t, filepath.Join(output.PlanDir, "a.txt")))
+}
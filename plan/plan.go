@@ -5,8 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Clever/microplane/git"
+	"github.com/Clever/microplane/lib"
 )
 
 // Command represents a command to run.
@@ -15,94 +22,426 @@ type Command struct {
 	Args []string
 }
 
+// Operation is a built-in change, made in-process instead of by running a Command
+type Operation interface {
+	// Apply makes the change in dir, recording what it did in output
+	Apply(ctx context.Context, dir string, changeCtx Context, output *Output) error
+}
+
+// Step is one step of making a change: a Command to run or an Operation to apply
+type Step struct {
+	// Command to run, unless Operation is set
+	Command Command
+	// Operation to apply
+	Operation Operation
+	// Message to commit the step's changes with. Without one, they are committed with the next step's.
+	Message string
+}
+
+// Commit is a commit made by Plan
+type Commit struct {
+	SHA     string
+	Message string
+	// Signature status of the commit, one of the git.Signature* values
+	Signature string `json:",omitempty"`
+}
+
 // Input for Plan
 type Input struct {
-	// RepoName
-	RepoName string
-	// RepoDir is where the git repo to modify lives. It will be copied into WorkDir
+	// Repo being planned
+	Repo lib.Repo
+	// RepoDir is where the git repo to modify lives. It will be checked out as a worktree in WorkDir
 	RepoDir string
 	// WorkDir is where we will store some results:
-	//   - {WorkDir}/plan: stores a copy of repodir but with a new commit containing changes
+	//   - {WorkDir}/planned: stores a worktree of repodir with a new commit containing changes
+	//   - {WorkDir}/context.json: the Context of the change command
+	//   - {WorkDir}/diff.patch: the git diff of the change, see DiffFile
+	//   - {WorkDir}/sandbox: HOME and TMPDIR of the change command, when sandboxed
+	//   - {WorkDir}/stdout.log, {WorkDir}/stderr.log: the change command's output, timestamped and bounded to MaxLogBytes
 	WorkDir string
 	// Command to run
 	Command Command
-	// CommitMessage to send to `git commit -m`
+	// Operation to apply instead of running Command
+	Operation Operation
+	// Steps to make instead of running Command or applying Operation
+	Steps []Step
+	// Validate runs the repo's checks on the committed change with `sh -c`, e.g. `go build ./...`
+	Validate []string
+	// CommitMessage to send to `git commit -m`, for changes not committed by a Step.
+	// Without one, they are committed with the last step's message, which then also names the change.
 	CommitMessage string
 	// BranchName where the commit will be made
 	BranchName string
+	// BaseBranch to make the commit on top of. Defaults to the branch checked out in RepoDir.
+	BaseBranch string
+	// Campaign the change is part of, for the change command's context. Defaults to BranchName.
+	Campaign string
+	// Vars for the repo from the repos file, for the change command's context
+	Vars map[string]string
 	// Whether to display the diff of changes made
 	Diff bool
 	// AllowEmptyCommit is whether to allow an empty commit
 	AllowEmptyCommit bool
+	// Author and Committer of the commits, instead of the git config's identity
+	Author    git.Identity
+	Committer git.Identity
+	// Signoff adds a Signed-off-by trailer for the committer to every commit, for repos requiring a DCO
+	Signoff bool
+	// Trailers to add to every commit message, e.g. "Co-authored-by: Jane Doe <jane@example.com>"
+	Trailers []string
+	// Signing of the commits
+	Signing git.Signing
+	// Timeout for the change: its steps, commits and validation. Zero means no timeout.
+	Timeout time.Duration
+	// Limits on the resources the change command may use
+	Limits Limits
+	// Sandbox isolates the change command from the user's machine
+	Sandbox Sandbox
+	// Git performs the checkout, commit and diff
+	Git git.Git
+	// Previous plan's output. If it was successful and would make the same change, it's kept instead of planning again.
+	Previous Output
+	// Force planning again, even if the Previous plan would make the same change
+	Force bool
 }
 
 // Output for Plan
 type Output struct {
 	Success bool
 
-	PlanDir       string
-	GitDiff       string
+	PlanDir string
+	// DiffPath is the DiffFile the git diff of the change is saved in, see OpenDiff and ReadDiff
+	DiffPath string
+	// DiffSHA identifies the diff, to tell whether it changed without reading it
+	DiffSHA string
+	// DiffStat of the diff
+	DiffStat DiffStat
+	// GitDiff is where plans made before DiffFile kept their diff. It's only read, see OpenDiff.
+	GitDiff       string `json:",omitempty"`
 	CommitMessage string
 	BranchName    string
+	BaseBranch    string
+	// BaseSHA is the commit of BaseBranch the change was made on top of
+	BaseSHA string
+	// Replacements made by the Replace operation, per file
+	Replacements map[string]int `json:",omitempty"`
+	// Edits made by the Edit operation, per file
+	Edits map[string]int `json:",omitempty"`
+	// GoModChanges made by the GoMod operation
+	GoModChanges []GoModChange `json:",omitempty"`
+	// PatchResult of the Patch operation: PatchApplied, PatchConflict or PatchRejected
+	PatchResult string `json:",omitempty"`
+	// PatchFiles with conflicts or rejected hunks, when the patch didn't apply cleanly
+	PatchFiles []string `json:",omitempty"`
+	// SkipReason explains why the operation didn't apply to the repo, if it didn't.
+	// Skipped repos are neither successfully planned nor failed.
+	SkipReason string `json:",omitempty"`
+	// NoOp is set when the change left the repo unchanged.
+	// No-op repos are neither successfully planned nor failed, and are not pushed.
+	NoOp bool `json:",omitempty"`
+	// Commits made on top of BaseSHA
+	Commits []Commit `json:",omitempty"`
+	// Validations of the change by Input.Validate's checks
+	Validations []Validation `json:",omitempty"`
+	// KilledReason explains why the change command was killed, if it was
+	KilledReason string `json:",omitempty"`
+	// Template data the branch name and commit messages were rendered with, and the PR body will be
+	Template TemplateData
+	// Fingerprint of the plan's inputs, to tell whether planning again would make the same change
+	Fingerprint string `json:",omitempty"`
+	// UpToDate is set when Input.Previous was kept instead of planning again
+	UpToDate bool `json:"-"`
 }
 
-// Plan creates a copy of the cloned repo and executes a command on it.
+// Plan creates a worktree of the cloned repo and executes a command on it.
 // This allows the user to preview a change to the repo.
 func Plan(ctx context.Context, input Input) (Output, error) {
-	// create a copy of the cloned repo and run all commands there
-	// wipe out the directory in case Plan has been run previously
+	// create a worktree of the cloned repo and run all commands there
+	// wipe out the worktree in case Plan has been run previously
 	// but the change command has been edited and you want to run again
 	planDir := path.Join(input.WorkDir, "planned")
-	if err := os.RemoveAll(planDir); err != nil {
-		return Output{Success: false}, fmt.Errorf("could not clear directory %s", planDir)
-	}
-	cmd := exec.CommandContext(ctx, "cp", "-a", "./.", planDir) // "./." copies all the contents of the current directory into the target directory
-	cmd.Dir = input.RepoDir
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return Output{Success: false}, errors.New(string(output))
-	}
-
-	// run the change command, git add, and git commit
-	cmds := []Command{
-		input.Command,
-		{Path: "git", Args: []string{"checkout", "-b", input.BranchName}},
-		{Path: "git", Args: []string{"add", "-A"}},
-	}
-	if input.AllowEmptyCommit {
-		cmds = append(cmds, Command{Path: "git", Args: []string{"commit", "--allow-empty", "-m", input.CommitMessage}})
-	} else {
-		cmds = append(cmds, Command{Path: "git", Args: []string{"commit", "-m", input.CommitMessage}})
-	}
-	for _, cmd := range cmds {
-		execCmd := exec.CommandContext(ctx, cmd.Path, cmd.Args...)
-		execCmd.Dir = planDir
-		// Set MICROPLANE_<X> convenience env vars, for use in user's script
-		execCmd.Env = append(os.Environ(), fmt.Sprintf("MICROPLANE_REPO=%s", input.RepoName))
-		if output, err := execCmd.CombinedOutput(); err != nil {
-			var exerr *exec.ExitError
-			if errors.As(err, &exerr) {
-				return Output{Success: false}, fmt.Errorf("[%s] %s", exerr, output)
-			} else {
-				return Output{Success: false}, err
+	defaultBranch, err := input.Git.CurrentBranch(ctx, input.RepoDir)
+	if err != nil {
+		return Output{Success: false}, err
+	}
+	baseBranch := input.BaseBranch
+	if baseBranch == "" {
+		baseBranch = defaultBranch
+	}
+
+	// keep the previous plan if it would make the same change
+	baseSHA, err := input.Git.RevParse(ctx, input.RepoDir, "origin/"+baseBranch)
+	if err != nil {
+		return Output{Success: false}, err
+	}
+	fingerprint, err := input.fingerprint(baseSHA)
+	if err != nil {
+		return Output{Success: false}, err
+	}
+	if !input.Force && input.Previous.Success && input.Previous.Fingerprint == fingerprint {
+		if _, err := os.Stat(input.Previous.PlanDir); err == nil {
+			output := input.Previous
+			output.UpToDate = true
+			return output, nil
+		}
+	}
+
+	if err := input.Git.RemoveWorktree(ctx, input.RepoDir, planDir); err != nil {
+		return Output{Success: false}, fmt.Errorf("could not clear directory %s: %w", planDir, err)
+	}
+	if err := input.Git.AddWorktree(ctx, input.RepoDir, planDir, "origin/"+baseBranch); err != nil {
+		return Output{Success: false}, err
+	}
+
+	// describe the repo to the change command, and to the templates
+	data := TemplateData{
+		Repo:          input.Repo.Name,
+		Owner:         input.Repo.Owner,
+		FullName:      fmt.Sprintf("%s/%s", input.Repo.Owner, input.Repo.Name),
+		DefaultBranch: defaultBranch,
+		BaseBranch:    baseBranch,
+		Vars:          input.Vars,
+	}
+	branchName, err := RenderTemplate("branch", input.BranchName, data)
+	if err != nil {
+		return Output{Success: false, BaseSHA: baseSHA}, err
+	}
+	campaign := input.Campaign
+	if campaign == "" {
+		campaign = branchName
+	}
+	data.Campaign = campaign
+	changeCtx := Context{
+		Repo:          input.Repo,
+		FullName:      data.FullName,
+		DefaultBranch: defaultBranch,
+		BaseBranch:    baseBranch,
+		BaseSHA:       baseSHA,
+		Campaign:      campaign,
+		BranchName:    branchName,
+		Vars:          input.Vars,
+	}
+	contextPath, err := changeCtx.write(input.WorkDir)
+	if err != nil {
+		return Output{Success: false, BaseSHA: baseSHA}, err
+	}
+	if err := clearLogs(input.WorkDir); err != nil {
+		return Output{Success: false, BaseSHA: baseSHA}, err
+	}
+	for _, file := range []string{valuesFile, DiffFile} {
+		if err := os.Remove(filepath.Join(input.WorkDir, file)); err != nil && !os.IsNotExist(err) {
+			return Output{Success: false, BaseSHA: baseSHA}, err
+		}
+	}
+
+	// make the change, committing after every step with a message
+	output := Output{PlanDir: planDir, BranchName: branchName, BaseBranch: baseBranch, BaseSHA: baseSHA, Template: data, Fingerprint: fingerprint}
+	if err := input.Git.CheckoutBranch(ctx, planDir, branchName); err != nil {
+		return output, err
+	}
+	if input.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, input.Timeout)
+		defer cancel()
+	}
+	steps := input.Steps
+	if len(steps) == 0 {
+		steps = []Step{{Command: input.Command, Operation: input.Operation}}
+	}
+	skipped := []string{}
+	for _, step := range steps {
+		head, err := input.Git.HeadSHA(ctx, planDir)
+		if err != nil {
+			return output, err
+		}
+		if step.Operation != nil {
+			err = step.Operation.Apply(ctx, planDir, changeCtx, &output)
+		} else {
+			err = runCommand(ctx, input, step.Command, planDir, changeCtx.env(contextPath))
+		}
+		if err != nil {
+			var killed *KilledError
+			if !errors.As(err, &killed) && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				// an operation, like a Starlark script, stopped by the timeout
+				killed = &KilledError{Reason: timedOut(input.Timeout), Output: err.Error()}
+				err = killed
 			}
+			if killed != nil {
+				output.KilledReason = killed.Reason
+			}
+			return output, err
+		}
+		if err := recommit(ctx, input, planDir, head, &output); err != nil {
+			return output, err
+		}
+		if err := loadValues(input.WorkDir, &output); err != nil {
+			return output, err
+		}
+		if output.SkipReason != "" {
+			skipped = append(skipped, output.SkipReason)
+			output.SkipReason = ""
+			continue
+		}
+		if step.Message != "" {
+			if err := commit(ctx, input, planDir, step.Message, false, &output); err != nil && !errors.Is(err, git.ErrNothingToCommit) {
+				return output, err
+			}
+		}
+	}
+	if len(skipped) == len(steps) {
+		output.SkipReason = strings.Join(skipped, "; ")
+		return output, nil
+	}
+
+	// commit what's left, unless the steps made their own commits
+	message := input.CommitMessage
+	if message == "" {
+		message = steps[len(steps)-1].Message
+	}
+	output.CommitMessage, err = RenderTemplate("message", message, output.Template)
+	if err != nil {
+		return output, err
+	}
+	err = commit(ctx, input, planDir, message, input.AllowEmptyCommit && len(output.Commits) == 0, &output)
+	if err != nil && !errors.Is(err, git.ErrNothingToCommit) {
+		return output, err
+	}
+
+	// save the git diff next to the output, for review
+	diff, err := input.Git.Diff(ctx, planDir, baseSHA, "HEAD")
+	if err != nil {
+		return output, err
+	}
+	if err := writeDiff(input.WorkDir, diff, &output); err != nil {
+		return output, err
+	}
+	if diff == "" && !input.AllowEmptyCommit {
+		output.NoOp = true
+		return output, nil
+	}
+
+	// a change failing validation is still planned, so that it can be inspected, but isn't pushed
+	output.Validations = validate(ctx, input, planDir, changeCtx.env(contextPath))
+
+	output.Success = true
+	return output, nil
+}
+
+// commit adds and commits all changes in dir, recording the commit in output.
+// The message is a template, rendered with output.Template.
+func commit(ctx context.Context, input Input, dir, message string, allowEmpty bool, output *Output) error {
+	message, err := RenderTemplate("message", message, output.Template)
+	if err != nil {
+		return err
+	}
+	return commitAs(ctx, input, dir, message, input.Author, allowEmpty, output)
+}
+
+// recommit makes the commits a step made itself since from, e.g. with `git am`, again as the plan makes its own:
+// with its committer, trailers and signing. They keep their messages, and their authors unless input.Author is set.
+func recommit(ctx context.Context, input Input, dir, from string, output *Output) error {
+	revs, err := runGit(ctx, dir, "rev-list", "--reverse", from+"..HEAD")
+	if err != nil {
+		return err
+	}
+	shas := strings.Fields(revs)
+	if len(shas) == 0 {
+		return nil
+	}
+	type made struct {
+		author  git.Identity
+		message string
+	}
+	commits := []made{}
+	for _, sha := range shas {
+		info, err := runGit(ctx, dir, "log", "-1", "--format=%an%x00%ae%x00%B", sha)
+		if err != nil {
+			return err
+		}
+		parts := strings.SplitN(info, "\x00", 3)
+		if len(parts) != 3 {
+			return fmt.Errorf("can't read commit %s", sha)
+		}
+		author := input.Author
+		if author.IsZero() {
+			author = git.Identity{Name: parts[0], Email: parts[1]}
+		}
+		commits = append(commits, made{author, strings.TrimRight(parts[2], "\n")})
+	}
+
+	// commit each one's tree again, on top of the previous one
+	if _, err := runGit(ctx, dir, "reset", "--hard", from); err != nil {
+		return err
+	}
+	for i, c := range commits {
+		if _, err := runGit(ctx, dir, "read-tree", "-u", "--reset", shas[i]); err != nil {
+			return err
+		}
+		if err := commitAs(ctx, input, dir, c.message, c.author, true, output); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	// add the git diff to output, might be useful / convenient?
-	var gitDiff string
-	gitDiffCmd := exec.CommandContext(ctx, "git", "diff", "HEAD^", "HEAD")
-	gitDiffCmd.Dir = planDir
-	output, err := gitDiffCmd.CombinedOutput()
+// commitAs commits all changes in dir with message, as is but for the plan's trailers, by author
+func commitAs(ctx context.Context, input Input, dir, message string, author git.Identity, allowEmpty bool, output *Output) error {
+	if err := input.Git.AddAll(ctx, dir); err != nil {
+		return err
+	}
+	message = addTrailers(message, input.Trailers)
+	opts := git.CommitOptions{
+		AllowEmpty: allowEmpty,
+		Author:     author,
+		Committer:  input.Committer,
+		Signoff:    input.Signoff,
+		Signing:    input.Signing,
+	}
+	if err := input.Git.Commit(ctx, dir, message, opts); err != nil {
+		return err
+	}
+	sha, err := input.Git.HeadSHA(ctx, dir)
 	if err != nil {
-		return Output{Success: false}, errors.New(string(output))
+		return err
 	}
-	gitDiff = string(output)
+	signature, err := input.Git.SignatureStatus(ctx, dir, sha)
+	if err != nil {
+		return err
+	}
+	output.Commits = append(output.Commits, Commit{SHA: sha, Message: message, Signature: signature})
+	return nil
+}
 
-	return Output{
-		Success:       true,
-		PlanDir:       planDir,
-		GitDiff:       gitDiff,
-		BranchName:    input.BranchName,
-		CommitMessage: input.CommitMessage,
-	}, nil
+// addTrailers adds trailers to the end of message, except those it already has
+func addTrailers(message string, trailers []string) string {
+	lines := strings.Split(message, "\n")
+	missing := []string{}
+	for _, trailer := range trailers {
+		if !slices.Contains(lines, trailer) && !slices.Contains(missing, trailer) {
+			missing = append(missing, trailer)
+		}
+	}
+	if len(missing) == 0 {
+		return message
+	}
+	message = strings.TrimRight(message, "\n")
+	// continue the message's own trailers, if its last paragraph is made of them
+	paragraphs := strings.Split(message, "\n\n")
+	separator := "\n\n"
+	if len(paragraphs) > 1 && isTrailers(paragraphs[len(paragraphs)-1]) {
+		separator = "\n"
+	}
+	return message + separator + strings.Join(missing, "\n")
+}
+
+// trailerPattern matches a git trailer, e.g. "Signed-off-by: Jane Doe <jane@example.com>"
+var trailerPattern = regexp.MustCompile(`^[A-Za-z0-9-]+: `)
+
+func isTrailers(paragraph string) bool {
+	for _, line := range strings.Split(paragraph, "\n") {
+		if !trailerPattern.MatchString(line) {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,337 @@
+package plan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/git"
+	"github.com/Clever/microplane/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cloneTestRepo clones a new repo with an empty commit on main
+func cloneTestRepo(t *testing.T, g git.Git) string {
+	for _, v := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(v, "test")
+	}
+	for _, v := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(v, "test@example.com")
+	}
+	origin := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-b", "main"},
+		{"commit", "--allow-empty", "-m", "initial commit"},
+	} {
+		out, err := exec.Command("git", append([]string{"-C", origin}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	repoDir := filepath.Join(t.TempDir(), "clone")
+	require.NoError(t, g.Clone(context.Background(), origin, repoDir))
+	return repoDir
+}
+
+func TestPlanNoOp(t *testing.T) {
+	ctx := context.Background()
+	g := &git.Exec{}
+	repoDir := cloneTestRepo(t, g)
+	input := Input{
+		RepoDir:       repoDir,
+		WorkDir:       t.TempDir(),
+		Command:       Command{Path: "true"},
+		CommitMessage: "Nothing",
+		BranchName:    "noop",
+		Git:           g,
+	}
+
+	output, err := Plan(ctx, input)
+	require.NoError(t, err)
+	assert.True(t, output.NoOp)
+	assert.False(t, output.Success)
+	assert.Empty(t, output.Commits)
+
+	// an empty commit is a change, when asked for
+	input.AllowEmptyCommit = true
+	output, err = Plan(ctx, input)
+	require.NoError(t, err)
+	assert.False(t, output.NoOp)
+	assert.True(t, output.Success)
+	assert.Len(t, output.Commits, 1)
+}
+
+func TestPlanValidate(t *testing.T) {
+	ctx := context.Background()
+	g := &git.Exec{}
+	repoDir := cloneTestRepo(t, g)
+
+	output, err := Plan(ctx, Input{
+		RepoDir:       repoDir,
+		WorkDir:       t.TempDir(),
+		Command:       Command{Path: "sh", Args: []string{"-c", "echo hi > a.txt"}},
+		Validate:      []string{"test -f a.txt", "echo broken >&2; exit 1"},
+		CommitMessage: "Add a",
+		BranchName:    "validate",
+		Git:           g,
+	})
+	require.NoError(t, err)
+	assert.True(t, output.Success)
+	require.Len(t, output.Validations, 2)
+	assert.Equal(t, Validation{Command: "test -f a.txt", Passed: true}, output.Validations[0])
+	assert.False(t, output.Validations[1].Passed)
+	assert.Contains(t, output.Validations[1].Error, "broken")
+	assert.Equal(t, []string{"echo broken >&2; exit 1"}, output.FailedValidations())
+}
+
+func TestPlanTimeout(t *testing.T) {
+	ctx := context.Background()
+	g := &git.Exec{}
+	repoDir := cloneTestRepo(t, g)
+	script := filepath.Join(t.TempDir(), "loop.star")
+	require.NoError(t, os.WriteFile(script, []byte("def loop():\n    for i in range(1 << 40):\n        pass\n\nloop()\n"), 0644))
+	op, err := NewStarlark(script)
+	require.NoError(t, err)
+
+	// the timeout applies to operations, not only to commands
+	start := time.Now()
+	output, err := Plan(ctx, Input{
+		RepoDir:       repoDir,
+		WorkDir:       t.TempDir(),
+		Operation:     op,
+		CommitMessage: "Loop",
+		BranchName:    "loop",
+		Timeout:       100 * time.Millisecond,
+		Git:           g,
+	})
+	var killed *KilledError
+	require.True(t, errors.As(err, &killed), "expected KilledError, got %v", err)
+	assert.Equal(t, "timed out after 100ms", output.KilledReason)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestPlanUpToDate(t *testing.T) {
+	ctx := context.Background()
+	g := &git.Exec{}
+	script := filepath.Join(t.TempDir(), "change.sh")
+	writeFiles(t, filepath.Dir(script), map[string]string{"change.sh": "echo v1 > v.txt\n"})
+	input := Input{
+		RepoDir:       cloneTestRepo(t, g),
+		WorkDir:       t.TempDir(),
+		Command:       Command{Path: "sh", Args: []string{script}},
+		CommitMessage: "Add v",
+		BranchName:    "fingerprint",
+		Git:           g,
+	}
+
+	first, err := Plan(ctx, input)
+	require.NoError(t, err)
+	require.True(t, first.Success)
+	assert.NotEmpty(t, first.Fingerprint)
+
+	input.Previous = first
+	output, err := Plan(ctx, input)
+	require.NoError(t, err)
+	assert.True(t, output.UpToDate)
+	assert.Equal(t, first.Commits, output.Commits)
+
+	input.Force = true
+	output, err = Plan(ctx, input)
+	require.NoError(t, err)
+	assert.False(t, output.UpToDate)
+	assert.Equal(t, first.Fingerprint, output.Fingerprint)
+
+	// editing the script plans again
+	input.Force = false
+	writeFiles(t, filepath.Dir(script), map[string]string{"change.sh": "echo v2 > v.txt\n"})
+	output, err = Plan(ctx, input)
+	require.NoError(t, err)
+	assert.False(t, output.UpToDate)
+	assert.NotEqual(t, first.Fingerprint, output.Fingerprint)
+	assert.Equal(t, "v2\n", readFile(t, filepath.Join(output.PlanDir, "v.txt")))
+
+	// as does changing the message
+	input.Previous = output
+	input.CommitMessage = "Add v2"
+	output, err = Plan(ctx, input)
+	require.NoError(t, err)
+	assert.False(t, output.UpToDate)
+}
+
+func TestPlanUpToDateStarlarkModules(t *testing.T) {
+	ctx := context.Background()
+	g := &git.Exec{}
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"change.star":      "load(\"lib/version.star\", \"version\")\nfs.write(\"v.txt\", version)\n",
+		"lib/version.star": "load(\"lib/base.star\", \"base\")\nversion = base + \".1\"\n",
+		"lib/base.star":    `base = "1"`,
+	})
+	starlark, err := NewStarlark(filepath.Join(dir, "change.star"))
+	require.NoError(t, err)
+	input := Input{
+		RepoDir:       cloneTestRepo(t, g),
+		WorkDir:       t.TempDir(),
+		Operation:     starlark,
+		CommitMessage: "Add v",
+		BranchName:    "modules",
+		Git:           g,
+	}
+	first, err := Plan(ctx, input)
+	require.NoError(t, err)
+	require.True(t, first.Success)
+	assert.Equal(t, "1.1", readFile(t, filepath.Join(first.PlanDir, "v.txt")))
+
+	// editing a module loaded by a module plans again
+	input.Previous = first
+	writeFiles(t, dir, map[string]string{"lib/base.star": `base = "2"`})
+	output, err := Plan(ctx, input)
+	require.NoError(t, err)
+	assert.False(t, output.UpToDate)
+	assert.Equal(t, "2.1", readFile(t, filepath.Join(output.PlanDir, "v.txt")))
+}
+
+func TestPlanContext(t *testing.T) {
+	ctx := context.Background()
+	g := &git.Exec{}
+	workDir := t.TempDir()
+	repo := lib.Repo{Owner: "acme", Name: "app", ProviderConfig: lib.ProviderConfig{Backend: "github", BackendURL: "https://github.example.com"}}
+	output, err := Plan(ctx, Input{
+		Repo:          repo,
+		RepoDir:       cloneTestRepo(t, g),
+		WorkDir:       workDir,
+		Command:       Command{Path: "sh", Args: []string{"-c", `env | grep ^MICROPLANE_ | sort > env.txt; cp "$MICROPLANE_CONTEXT" context.json`}},
+		CommitMessage: "Dump the context",
+		BranchName:    "context-{{.Repo}}",
+		Campaign:      "dump",
+		Vars:          map[string]string{"team": "infra", "tier": "1"},
+		Git:           g,
+	})
+	require.NoError(t, err)
+	require.True(t, output.Success)
+
+	env := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(readFile(t, filepath.Join(output.PlanDir, "env.txt"))), "\n") {
+		kv := strings.SplitN(line, "=", 2)
+		require.Len(t, kv, 2, line)
+		env[kv[0]] = kv[1]
+	}
+	contextPath := filepath.Join(workDir, contextFile)
+	assert.Equal(t, map[string]string{
+		"MICROPLANE_REPO":           "app",
+		"MICROPLANE_OWNER":          "acme",
+		"MICROPLANE_FULL_NAME":      "acme/app",
+		"MICROPLANE_PROVIDER":       "github",
+		"MICROPLANE_PROVIDER_URL":   "https://github.example.com",
+		"MICROPLANE_DEFAULT_BRANCH": "main",
+		"MICROPLANE_BASE_BRANCH":    "main",
+		"MICROPLANE_BASE_SHA":       output.BaseSHA,
+		"MICROPLANE_CAMPAIGN":       "dump",
+		"MICROPLANE_BRANCH":         "context-app",
+		"MICROPLANE_CONTEXT":        contextPath,
+		"MICROPLANE_VALUES":         filepath.Join(workDir, valuesFile),
+	}, env)
+
+	// the context file has the same, plus the repo's variables, and is kept out of the worktree
+	var written Context
+	require.NoError(t, json.Unmarshal([]byte(readFile(t, filepath.Join(output.PlanDir, "context.json"))), &written))
+	assert.Equal(t, Context{
+		Repo:          repo,
+		FullName:      "acme/app",
+		DefaultBranch: "main",
+		BaseBranch:    "main",
+		BaseSHA:       output.BaseSHA,
+		Campaign:      "dump",
+		BranchName:    "context-app",
+		Vars:          map[string]string{"team": "infra", "tier": "1"},
+	}, written)
+	assert.FileExists(t, contextPath)
+	assert.False(t, strings.HasPrefix(contextPath, output.PlanDir+string(filepath.Separator)))
+}
+
+func TestPlanTemplates(t *testing.T) {
+	ctx := context.Background()
+	g := &git.Exec{}
+	output, err := Plan(ctx, Input{
+		Repo:          lib.Repo{Owner: "acme", Name: "app"},
+		RepoDir:       cloneTestRepo(t, g),
+		WorkDir:       t.TempDir(),
+		Command:       Command{Path: "sh", Args: []string{"-c", `echo 1.2.3 > VERSION; echo '{"version": "1.2.3"}' > "$MICROPLANE_VALUES"`}},
+		CommitMessage: "Bump {{.Repo}} to {{.Values.version}} for {{.Vars.team}}",
+		BranchName:    "bump-{{.Repo}}",
+		Vars:          map[string]string{"team": "infra"},
+		Git:           g,
+	})
+	require.NoError(t, err)
+	require.True(t, output.Success)
+	assert.Equal(t, "bump-app", output.BranchName)
+	assert.Equal(t, "Bump app to 1.2.3 for infra", output.CommitMessage)
+	require.Len(t, output.Commits, 1)
+	assert.Equal(t, output.CommitMessage, output.Commits[0].Message)
+	assert.Equal(t, "bump-app", output.Template.Campaign)
+
+	body, err := RenderTemplate("body", "Bumps {{.FullName}} to {{.Values.version}}", output.Template)
+	require.NoError(t, err)
+	assert.Equal(t, "Bumps acme/app to 1.2.3", body)
+
+	// values missing from the templates fail the plan
+	_, err = Plan(ctx, Input{
+		Repo:          lib.Repo{Owner: "acme", Name: "app"},
+		RepoDir:       cloneTestRepo(t, g),
+		WorkDir:       t.TempDir(),
+		Command:       Command{Path: "sh", Args: []string{"-c", "echo 1.2.3 > VERSION"}},
+		CommitMessage: "Bump to {{.Values.version}}",
+		BranchName:    "bump",
+		Git:           g,
+	})
+	assert.Error(t, err)
+	assert.Error(t, CheckTemplate("message", "Bump {{.Repo"))
+}
+
+func TestPlanCommitOptions(t *testing.T) {
+	ctx := context.Background()
+	g := &git.Exec{}
+	output, err := Plan(ctx, Input{
+		RepoDir:       cloneTestRepo(t, g),
+		WorkDir:       t.TempDir(),
+		Command:       Command{Path: "sh", Args: []string{"-c", "echo hi > a.txt"}},
+		CommitMessage: "Add a",
+		BranchName:    "identity",
+		Author:        git.Identity{Name: "Jane Doe", Email: "jane@example.com"},
+		Committer:     git.Identity{Name: "Bot", Email: "bot@example.com"},
+		Signoff:       true,
+		Trailers:      []string{"Co-authored-by: John Doe <john@example.com>"},
+		Git:           g,
+	})
+	require.NoError(t, err)
+	require.True(t, output.Success)
+	require.Len(t, output.Commits, 1)
+	assert.Equal(t, git.SignatureNone, output.Commits[0].Signature)
+
+	out, err := exec.Command("git", "-C", output.PlanDir, "log", "-1", "--format=%an <%ae>|%cn <%ce>|%B").CombinedOutput()
+	require.NoError(t, err, string(out))
+	assert.Equal(t, "Jane Doe <jane@example.com>|Bot <bot@example.com>|Add a\n\n"+
+		"Co-authored-by: John Doe <john@example.com>\nSigned-off-by: Bot <bot@example.com>\n\n", string(out))
+}
+
+func TestAddTrailers(t *testing.T) {
+	coAuthor := "Co-authored-by: Jane Doe <jane@example.com>"
+	for _, tc := range []struct {
+		message  string
+		expected string
+	}{
+		{"Fix", "Fix\n\n" + coAuthor},
+		{"Fix\n", "Fix\n\n" + coAuthor},
+		{"Fix\n\nRefs: #1\n", "Fix\n\nRefs: #1\n" + coAuthor},
+		{"Fix\n\n" + coAuthor, "Fix\n\n" + coAuthor},
+		{"Fix: the bug", "Fix: the bug\n\n" + coAuthor},
+	} {
+		assert.Equal(t, tc.expected, addTrailers(tc.message, []string{coAuthor, coAuthor}), tc.message)
+	}
+	assert.Equal(t, "Fix", addTrailers("Fix", nil))
+}
@@ -0,0 +1,263 @@
+package plan
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Recipe describes a change as an ordered list of steps, e.g.
+//
+//	message: Upgrade node
+//	steps:
+//	  - run: npm install node@20
+//	    message: Install node 20
+//	  - edit:
+//	      files: [package.json]
+//	      actions:
+//	        - {op: set, path: engines.node, value: ">=20"}
+//	  - recipe: lint.yml
+type Recipe struct {
+	// Message to commit changes not committed by a step with
+	Message string       `yaml:"message,omitempty"`
+	Steps   []RecipeStep `yaml:"steps"`
+}
+
+// RecipeStep is one step of a Recipe. Exactly one of Run, Replace, Edit, GoMod, Starlark, Patch or Recipe is set.
+type RecipeStep struct {
+	// Message to commit the step's changes with. Without one, they are committed with the next step's.
+	Message string `yaml:"message,omitempty"`
+	// Run a command, either a shell command line or a list of arguments
+	Run RecipeCommand `yaml:"run,omitempty"`
+	// Replace a regular expression in files
+	Replace *Replace `yaml:"replace,omitempty"`
+	// Edit values in YAML, JSON and TOML files
+	Edit *Edit `yaml:"edit,omitempty"`
+	// GoMod bumps Go module dependencies
+	GoMod *RecipeGoMod `yaml:"gomod,omitempty"`
+	// Starlark script to run, relative to this recipe
+	Starlark string `yaml:"starlark,omitempty"`
+	// Patch to apply, relative to this recipe
+	Patch string `yaml:"patch,omitempty"`
+	// Recipe to include, relative to this recipe. Its message commits its changes.
+	Recipe string `yaml:"recipe,omitempty"`
+}
+
+// RecipeGoMod configures the GoMod operation in a recipe
+type RecipeGoMod struct {
+	// Require modules, as `module@version`
+	Require []string `yaml:"require"`
+	Tidy    bool     `yaml:"tidy,omitempty"`
+}
+
+// RecipeCommand is a command's arguments. In YAML, it may also be a string run with `sh -c`.
+type RecipeCommand []string
+
+// UnmarshalYAML accepts a string or a list of strings
+func (c *RecipeCommand) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*c = RecipeCommand{"sh", "-c", node.Value}
+		return nil
+	}
+	var args []string
+	if err := node.Decode(&args); err != nil {
+		return err
+	}
+	*c = args
+	return nil
+}
+
+// LoadRecipe reads a recipe, and includes the recipes it refers to
+func LoadRecipe(path string) (*Recipe, error) {
+	return loadRecipe(path, map[string]bool{})
+}
+
+func loadRecipe(path string, including map[string]bool) (*Recipe, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if including[abs] {
+		return nil, fmt.Errorf("recipe %s includes itself", path)
+	}
+	including[abs] = true
+	defer delete(including, abs)
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var recipe Recipe
+	if err := yaml.Unmarshal(b, &recipe); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	steps := []RecipeStep{}
+	for _, step := range recipe.Steps {
+		if step.Starlark != "" && !filepath.IsAbs(step.Starlark) {
+			step.Starlark = filepath.Join(filepath.Dir(abs), step.Starlark)
+		}
+		if step.Patch != "" && !filepath.IsAbs(step.Patch) {
+			step.Patch = filepath.Join(filepath.Dir(abs), step.Patch)
+		}
+		if step.Recipe == "" {
+			steps = append(steps, step)
+			continue
+		}
+		if !filepath.IsAbs(step.Recipe) {
+			step.Recipe = filepath.Join(filepath.Dir(abs), step.Recipe)
+		}
+		included, err := loadRecipe(step.Recipe, including)
+		if err != nil {
+			return nil, err
+		}
+		// the included recipe's leftover changes are committed with its message, or else this step's
+		message := step.Message
+		if included.Message != "" {
+			message = included.Message
+		}
+		last := &included.Steps[len(included.Steps)-1]
+		if last.Message == "" {
+			last.Message = message
+		}
+		steps = append(steps, included.Steps...)
+	}
+	recipe.Steps = steps
+	if _, err := recipe.PlanSteps(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &recipe, nil
+}
+
+// PlanSteps validates the recipe's steps, converting them for Plan. Included recipes must already be loaded.
+func (r *Recipe) PlanSteps() ([]Step, error) {
+	if len(r.Steps) == 0 {
+		return nil, fmt.Errorf("recipe has no steps")
+	}
+	steps := []Step{}
+	for i, rs := range r.Steps {
+		step := Step{Message: rs.Message}
+		set := 0
+		for _, isSet := range []bool{len(rs.Run) > 0, rs.Replace != nil, rs.Edit != nil, rs.GoMod != nil, rs.Starlark != "", rs.Patch != "", rs.Recipe != ""} {
+			if isSet {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("step %d: must have exactly one of run, replace, edit, gomod, starlark, patch or recipe", i+1)
+		}
+
+		var err error
+		switch {
+		case len(rs.Run) > 0:
+			step.Command = Command{Path: rs.Run[0], Args: rs.Run[1:]}
+		case rs.Replace != nil:
+			step.Operation, err = NewReplace(rs.Replace.Files, rs.Replace.Pattern, rs.Replace.Replacement, rs.Replace.Multiline)
+		case rs.Edit != nil:
+			step.Operation, err = NewEdit(rs.Edit.Files, rs.Edit.Actions)
+		case rs.GoMod != nil:
+			step.Operation, err = NewGoMod(rs.GoMod.Require, rs.GoMod.Tidy)
+		case rs.Starlark != "":
+			step.Operation, err = NewStarlark(rs.Starlark)
+		case rs.Patch != "":
+			step.Operation, err = NewPatch(rs.Patch)
+		case rs.Recipe != "":
+			err = fmt.Errorf("recipe %s isn't loaded", rs.Recipe)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %w", i+1, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// Save writes the recipe, with its included recipes inlined, so the change can be planned again.
+// The steps' Starlark scripts, with the modules they load, and patches are copied next to it, in a directory
+// named after it, e.g. recipe-files/ for recipe.yml, so the saved recipe doesn't depend on files that may change.
+func (r *Recipe) Save(path string) error {
+	filesDir := strings.TrimSuffix(path, filepath.Ext(path)) + "-files"
+	if err := os.RemoveAll(filesDir); err != nil {
+		return err
+	}
+	saved := *r
+	saved.Steps = slices.Clone(r.Steps)
+	for i := range saved.Steps {
+		step := &saved.Steps[i]
+		var stepPath *string
+		var files []string
+		switch {
+		case step.Starlark != "":
+			var err error
+			stepPath = &step.Starlark
+			if files, err = (&Starlark{Path: step.Starlark}).files(); err != nil {
+				return fmt.Errorf("step %d: %w", i+1, err)
+			}
+		case step.Patch != "":
+			stepPath = &step.Patch
+			files = []string{step.Patch}
+		default:
+			continue
+		}
+		copied, err := copyFiles(files, filepath.Join(filesDir, strconv.Itoa(i+1)))
+		if err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+		if *stepPath, err = filepath.Rel(filepath.Dir(path), copied); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(saved); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// copyFiles copies files into dir, keeping their layout relative to each other, and returns where the first is copied
+func copyFiles(files []string, dir string) (string, error) {
+	abs := []string{}
+	for _, f := range files {
+		a, err := filepath.Abs(f)
+		if err != nil {
+			return "", err
+		}
+		abs = append(abs, a)
+	}
+	// the layout is kept from the closest directory holding all the files
+	root := filepath.Dir(abs[0])
+	for _, a := range abs {
+		for rel, err := filepath.Rel(root, a); err != nil || !filepath.IsLocal(rel); rel, err = filepath.Rel(root, a) {
+			root = filepath.Dir(root)
+		}
+	}
+	copied := []string{}
+	for _, a := range abs {
+		rel, err := filepath.Rel(root, a)
+		if err != nil {
+			return "", err
+		}
+		b, err := os.ReadFile(a)
+		if err != nil {
+			return "", err
+		}
+		dest := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(dest, b, 0644); err != nil {
+			return "", err
+		}
+		copied = append(copied, dest)
+	}
+	return copied[0], nil
+}
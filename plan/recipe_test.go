@@ -0,0 +1,119 @@
+package plan
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/Clever/microplane/git"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRecipe(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.yml": `message: Main
+steps:
+  - run: echo hi > hi.txt
+    message: Say hi
+  - recipe: lib/format.yml
+  - run: [touch, done.txt]
+`,
+		"lib/format.yml": `message: Format
+steps:
+  - replace: {files: ["*.txt"], pattern: hi, replacement: hello}
+  - gomod: {require: [golang.org/x/net@v0.47.0]}
+  - starlark: bump.star
+`,
+		"lib/bump.star": "load(\"../version.star\", \"version\")\nfs.write(\"version.txt\", version)\n",
+		"version.star":  `version = "2"`,
+		"loop.yml":      "steps:\n  - recipe: loop.yml\n",
+		"bad.yml":       "steps:\n  - run: true\n    gomod: {require: [x@v1.0.0]}\n",
+	})
+
+	recipe, err := LoadRecipe(filepath.Join(dir, "main.yml"))
+	require.NoError(t, err)
+	assert.Equal(t, "Main", recipe.Message)
+	require.Len(t, recipe.Steps, 5)
+	assert.Equal(t, RecipeCommand{"sh", "-c", "echo hi > hi.txt"}, recipe.Steps[0].Run)
+	assert.Equal(t, "", recipe.Steps[1].Message)
+	assert.Equal(t, filepath.Join(dir, "lib/bump.star"), recipe.Steps[3].Starlark)
+	assert.Equal(t, "Format", recipe.Steps[3].Message)
+	assert.Equal(t, RecipeCommand{"touch", "done.txt"}, recipe.Steps[4].Run)
+
+	// the saved recipe has its included recipes inlined, and its own copy of the scripts and the modules they load
+	saved := filepath.Join(dir, "saved.yml")
+	require.NoError(t, recipe.Save(saved))
+	writeFiles(t, dir, map[string]string{"version.star": `version = "3"`})
+	reloaded, err := LoadRecipe(saved)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "saved-files/4/lib/bump.star"), reloaded.Steps[3].Starlark)
+	assert.Equal(t, `version = "2"`, readFile(t, filepath.Join(dir, "saved-files/4/version.star")))
+	reloaded.Steps[3].Starlark = recipe.Steps[3].Starlark
+	assert.Equal(t, recipe, reloaded)
+
+	// included recipes may also be given by absolute path
+	writeFiles(t, dir, map[string]string{"abs.yml": "steps:\n  - recipe: " + filepath.Join(dir, "lib/format.yml") + "\n"})
+	recipe, err = LoadRecipe(filepath.Join(dir, "abs.yml"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "lib/bump.star"), recipe.Steps[2].Starlark)
+
+	_, err = LoadRecipe(filepath.Join(dir, "loop.yml"))
+	assert.ErrorContains(t, err, "includes itself")
+	_, err = LoadRecipe(filepath.Join(dir, "bad.yml"))
+	assert.ErrorContains(t, err, "step 1: must have exactly one of")
+}
+
+func TestPlanSteps(t *testing.T) {
+	ctx := context.Background()
+	g := &git.Exec{}
+	repoDir := cloneTestRepo(t, g)
+
+	output, err := Plan(ctx, Input{
+		RepoDir:       repoDir,
+		WorkDir:       t.TempDir(),
+		CommitMessage: "Leftovers",
+		BranchName:    "steps",
+		Git:           g,
+		Steps: []Step{
+			{Command: Command{Path: "sh", Args: []string{"-c", "echo hi > a.txt"}}, Message: "Add a"},
+			{Operation: &Replace{Files: []string{"*.txt"}, Pattern: "hi", Replacement: "hello"}},
+			{Command: Command{Path: "touch", Args: []string{"b.txt"}}, Message: "Add b"},
+			{Command: Command{Path: "true"}, Message: "Nothing"},
+		},
+	})
+	require.NoError(t, err)
+	assert.True(t, output.Success)
+	require.Len(t, output.Commits, 2)
+	assert.Equal(t, "Add a", output.Commits[0].Message)
+	assert.Equal(t, "Add b", output.Commits[1].Message)
+	assert.Equal(t, map[string]int{"a.txt": 1}, output.Replacements)
+	diff, err := output.ReadDiff()
+	require.NoError(t, err)
+	assert.Contains(t, diff, "+hello")
+	assert.Contains(t, diff, "b.txt")
+	assert.Equal(t, "hello\n", readFile(t, filepath.Join(output.PlanDir, "a.txt")))
+}
+
+func TestPlanStepsWithoutMessage(t *testing.T) {
+	ctx := context.Background()
+	g := &git.Exec{}
+	repoDir := cloneTestRepo(t, g)
+
+	// without a commit message, leftover changes are committed with the last step's message, which names the change
+	output, err := Plan(ctx, Input{
+		RepoDir:    repoDir,
+		WorkDir:    t.TempDir(),
+		BranchName: "steps",
+		Git:        g,
+		Steps: []Step{
+			{Command: Command{Path: "touch", Args: []string{"a.txt"}}, Message: "Add a"},
+			{Command: Command{Path: "touch", Args: []string{"b.txt"}}, Message: "Add b"},
+		},
+	})
+	require.NoError(t, err)
+	assert.True(t, output.Success)
+	require.Len(t, output.Commits, 2)
+	assert.Equal(t, "Add b", output.CommitMessage)
+}
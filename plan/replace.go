@@ -0,0 +1,151 @@
+package plan
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// Replace is an Operation replacing matches of a regular expression in files
+type Replace struct {
+	// Files are glob patterns, relative to the repo root, of the files to edit. `**` matches any number of directories.
+	Files []string `yaml:"files"`
+	// Pattern is a regular expression in Go's RE2 syntax
+	Pattern string `yaml:"pattern"`
+	// Replacement for each match. $1 or ${name} refer to capture groups.
+	Replacement string `yaml:"replacement"`
+	// Multiline matches Pattern against whole files instead of line by line, so matches can span lines.
+	// ^ and $ still match at the start and end of each line.
+	Multiline bool `yaml:"multiline,omitempty"`
+}
+
+// NewReplace validates the replace operation's patterns
+func NewReplace(files []string, pattern, replacement string, multiline bool) (*Replace, error) {
+	if err := validateGlobs(files); err != nil {
+		return nil, err
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		return nil, err
+	}
+	return &Replace{Files: files, Pattern: pattern, Replacement: replacement, Multiline: multiline}, nil
+}
+
+// Apply replaces in every matching file in dir, counting the replacements per file in output.Replacements
+func (r *Replace) Apply(ctx context.Context, dir string, changeCtx Context, output *Output) error {
+	pattern := r.Pattern
+	if r.Multiline {
+		pattern = "(?m)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+
+	files, err := matchFiles(dir, r.Files)
+	if err != nil {
+		return err
+	}
+	if output.Replacements == nil {
+		output.Replacements = map[string]int{}
+	}
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// leave binary files alone
+		if bytes.IndexByte(contents, 0) != -1 {
+			continue
+		}
+		replaced, n := r.replace(re, contents)
+		if n == 0 {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, replaced, info.Mode().Perm()); err != nil {
+			return err
+		}
+		output.Replacements[file] += n
+	}
+	return nil
+}
+
+// replace returns the contents with every match replaced, and the number of matches
+func (r *Replace) replace(re *regexp.Regexp, contents []byte) ([]byte, int) {
+	if r.Multiline {
+		n := len(re.FindAllIndex(contents, -1))
+		return re.ReplaceAll(contents, []byte(r.Replacement)), n
+	}
+	total := 0
+	lines := bytes.SplitAfter(contents, []byte("\n"))
+	for i, line := range lines {
+		// match without the line ending, so $ matches at the end of the line
+		body := bytes.TrimSuffix(line, []byte("\n"))
+		n := len(re.FindAllIndex(body, -1))
+		if n == 0 {
+			continue
+		}
+		total += n
+		lines[i] = append(re.ReplaceAll(body, []byte(r.Replacement)), line[len(body):]...)
+	}
+	return bytes.Join(lines, nil), total
+}
+
+// validateGlobs checks the glob patterns for matchFiles
+func validateGlobs(globs []string) error {
+	if len(globs) == 0 {
+		return fmt.Errorf("no files given")
+	}
+	for _, glob := range globs {
+		if !doublestar.ValidatePattern(glob) {
+			return fmt.Errorf("invalid files pattern: %s", glob)
+		}
+	}
+	return nil
+}
+
+// matchFiles returns the regular files in dir, as slash-separated paths relative to dir, matching any of the globs.
+// git's metadata is skipped: the .git directory of a clone, or the .git file of a worktree.
+func matchFiles(dir string, globs []string) ([]string, error) {
+	files := []string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Name() == ".git" {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		for _, glob := range globs {
+			if doublestar.MatchUnvalidated(glob, rel) {
+				files = append(files, rel)
+				break
+			}
+		}
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,67 @@
+package plan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestReplace(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"launch/a.yml":   "team: eng-apps\nowner: eng-apps\n",
+		"launch/b/c.yml": "team: eng-apps\n",
+		"README.md":      "team: eng-apps\n",
+		".git":           "gitdir: team: eng-apps\n",
+	})
+
+	op, err := NewReplace([]string{"**/*.yml"}, `^(\w+): eng-(\w+)$`, "$1: eng-${2}-new", false)
+	require.NoError(t, err)
+	output := Output{}
+	require.NoError(t, op.Apply(context.Background(), dir, Context{}, &output))
+
+	assert.Equal(t, map[string]int{"launch/a.yml": 2, "launch/b/c.yml": 1}, output.Replacements)
+	assert.Equal(t, "team: eng-apps-new\nowner: eng-apps-new\n", readFile(t, filepath.Join(dir, "launch/a.yml")))
+	assert.Equal(t, "team: eng-apps\n", readFile(t, filepath.Join(dir, "README.md")))
+	assert.Equal(t, "gitdir: team: eng-apps\n", readFile(t, filepath.Join(dir, ".git")))
+}
+
+func TestReplaceMultiline(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"go.mod": "require (\n\tfoo v1\n)\n"})
+
+	op, err := NewReplace([]string{"go.mod"}, `require \(\n\tfoo v1\n\)`, "require foo v2", true)
+	require.NoError(t, err)
+	output := Output{}
+	require.NoError(t, op.Apply(context.Background(), dir, Context{}, &output))
+
+	assert.Equal(t, map[string]int{"go.mod": 1}, output.Replacements)
+	assert.Equal(t, "require foo v2\n", readFile(t, filepath.Join(dir, "go.mod")))
+}
+
+func TestNewReplaceInvalid(t *testing.T) {
+	_, err := NewReplace([]string{"*.yml"}, "(", "", false)
+	assert.Error(t, err)
+	_, err = NewReplace(nil, "a", "b", false)
+	assert.Error(t, err)
+	_, err = NewReplace([]string{"[a"}, "a", "b", false)
+	assert.Error(t, err)
+}
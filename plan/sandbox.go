@@ -0,0 +1,204 @@
+package plan
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Sandbox modes, from least to most isolated
+const (
+	// SandboxNone runs the change command with the user's environment
+	SandboxNone = "none"
+	// SandboxEnv strips secrets from the environment, and points HOME and TMPDIR into the plan's WorkDir
+	SandboxEnv = "env"
+	// SandboxNamespace additionally runs the command in Linux namespaces with bubblewrap (bwrap),
+	// where the home directories are hidden, everything else but the plan's WorkDir is read-only and,
+	// unless allowed, there is no network
+	SandboxNamespace = "namespace"
+	// SandboxContainer additionally runs the command in a container, where only the plan's WorkDir is mounted
+	// and, unless allowed, there is no network
+	SandboxContainer = "container"
+)
+
+// SandboxModes lists the valid values of Sandbox.Mode
+var SandboxModes = []string{SandboxNone, SandboxEnv, SandboxNamespace, SandboxContainer}
+
+// Sandbox configures how the change command is isolated from the user's machine
+type Sandbox struct {
+	// Mode is one of SandboxModes. Empty means SandboxNone.
+	Mode string
+	// Network allows network access in the namespace and container sandboxes
+	Network bool
+	// Image to run the command in, for the container sandbox
+	Image string
+	// Runtime is the OCI container runtime CLI, e.g. "docker" or "podman"
+	Runtime string
+}
+
+// Validate checks that the sandbox is configured correctly
+func (s Sandbox) Validate() error {
+	switch s.Mode {
+	case "", SandboxNone, SandboxEnv, SandboxNamespace:
+		return nil
+	case SandboxContainer:
+		if s.Image == "" {
+			return fmt.Errorf("the %s sandbox requires an image", SandboxContainer)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown sandbox mode '%s', must be one of: %s", s.Mode, strings.Join(SandboxModes, ", "))
+}
+
+// secretMarkers identify environment variables that shouldn't be visible to change commands
+var secretMarkers = []string{"TOKEN", "SECRET", "PASSWORD", "PASSWD", "CREDENTIAL", "API_KEY", "ACCESS_KEY", "PRIVATE_KEY", "AUTH"}
+
+// secretVars are environment variables that grant access to credentials without looking like secrets
+var secretVars = map[string]bool{"SSH_AUTH_SOCK": true, "GPG_AGENT_INFO": true}
+
+func isSecret(name string) bool {
+	upper := strings.ToUpper(name)
+	if secretVars[upper] || strings.HasPrefix(upper, "AWS_") {
+		return true
+	}
+	for _, marker := range secretMarkers {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripSecrets removes secrets from env, a list of KEY=value pairs
+func stripSecrets(env []string) []string {
+	stripped := []string{}
+	for _, kv := range env {
+		name := strings.SplitN(kv, "=", 2)[0]
+		if !isSecret(name) {
+			stripped = append(stripped, kv)
+		}
+	}
+	return stripped
+}
+
+// wrap returns the command and environment to run cmd with in the sandbox.
+// Scratch space for the command is created in {workDir}/sandbox.
+func (s Sandbox) wrap(cmd Command, env []string, workDir, dir string) (Command, []string, error) {
+	if s.Mode == "" || s.Mode == SandboxNone {
+		return cmd, env, nil
+	}
+	if err := s.Validate(); err != nil {
+		return cmd, env, err
+	}
+
+	absWorkDir, err := filepath.Abs(workDir)
+	if err != nil {
+		return cmd, env, err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return cmd, env, err
+	}
+	home := filepath.Join(absWorkDir, "sandbox", "home")
+	tmp := filepath.Join(absWorkDir, "sandbox", "tmp")
+	if err := os.RemoveAll(filepath.Join(absWorkDir, "sandbox")); err != nil {
+		return cmd, env, err
+	}
+	for _, d := range []string{home, tmp} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return cmd, env, err
+		}
+	}
+	env = append(stripSecrets(env), "HOME="+home, "TMPDIR="+tmp)
+
+	switch s.Mode {
+	case SandboxEnv:
+		return cmd, env, nil
+
+	case SandboxNamespace:
+		if _, err := exec.LookPath("bwrap"); err != nil {
+			return cmd, env, fmt.Errorf("the %s sandbox requires bubblewrap (bwrap) to be installed: %w", SandboxNamespace, err)
+		}
+		userHome, _ := os.UserHomeDir()
+		args := namespaceMounts(absWorkDir, absDir, userHome)
+		args = append(args, "--unshare-all", "--die-with-parent", "--chdir", absDir)
+		if s.Network {
+			args = append(args, "--share-net")
+		}
+		args = append(append(args, cmd.Path), cmd.Args...)
+		return Command{Path: "bwrap", Args: args}, env, nil
+
+	case SandboxContainer:
+		runtime := s.Runtime
+		if runtime == "" {
+			runtime = "docker"
+		}
+		args := []string{
+			"run", "--rm", "--init", "--read-only",
+			"--tmpfs", "/tmp",
+			"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+			"--volume", fmt.Sprintf("%s:%s", absWorkDir, absWorkDir),
+			"--workdir", absDir,
+		}
+		if !s.Network {
+			args = append(args, "--network", "none")
+		}
+		// the host's PATH etc. don't apply inside the image, so only pass through what microplane sets
+		for _, kv := range env {
+			if strings.HasPrefix(kv, "MICROPLANE_") || strings.HasPrefix(kv, "HOME=") || strings.HasPrefix(kv, "TMPDIR=") {
+				args = append(args, "--env", kv)
+			}
+		}
+		args = append(append(args, s.Image, cmd.Path), cmd.Args...)
+		return Command{Path: runtime, Args: args}, env, nil
+	}
+
+	return cmd, env, nil
+}
+
+// namespaceMounts returns bwrap's arguments to mount the filesystem for the namespace sandbox.
+// System directories like /usr and /etc stay visible, read-only, so that the command can run the machine's tools.
+// The home directories, where credentials like ~/.ssh, ~/.netrc or ~/.config/gh are kept, are replaced by empty ones,
+// which also hides tools installed there. Only the plan's WorkDir is writable, and the clone's git directory,
+// which the worktree in dir refers to, is visible read-only.
+func namespaceMounts(workDir, dir, userHome string) []string {
+	args := []string{
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+	}
+	hidden := []string{"/home", "/root"}
+	if userHome != "" && filepath.IsAbs(userHome) && !slices.Contains(hidden, filepath.Dir(userHome)) {
+		hidden = append(hidden, userHome)
+	}
+	for _, d := range hidden {
+		if info, err := os.Stat(d); err == nil && info.IsDir() && d != "/" {
+			args = append(args, "--tmpfs", d)
+		}
+	}
+	if gitDir := worktreeGitDir(dir); gitDir != "" {
+		args = append(args, "--ro-bind", gitDir, gitDir)
+	}
+	return append(args, "--bind", workDir, workDir)
+}
+
+// worktreeGitDir returns the git directory of the repo that the linked worktree in dir belongs to, if any
+func worktreeGitDir(dir string) string {
+	b, err := os.ReadFile(filepath.Join(dir, ".git"))
+	if err != nil {
+		return ""
+	}
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(b)), "gitdir: ")
+	if !ok {
+		return ""
+	}
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(dir, gitDir)
+	}
+	// the worktree's own git directory is in the repo's, under worktrees/<name>
+	return filepath.Dir(filepath.Dir(filepath.Clean(gitDir)))
+}
@@ -0,0 +1,56 @@
+package plan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripSecrets(t *testing.T) {
+	env := []string{"PATH=/bin", "GITHUB_API_TOKEN=abc", "MY_SECRET=x", "AWS_PROFILE=prod", "SSH_AUTH_SOCK=/tmp/agent", "LANG=C", "MICROPLANE_REPO=r"}
+	assert.Equal(t, []string{"PATH=/bin", "LANG=C", "MICROPLANE_REPO=r"}, stripSecrets(env))
+}
+
+func TestRunCommandSandboxEnv(t *testing.T) {
+	t.Setenv("GITHUB_API_TOKEN", "abc")
+	workDir := t.TempDir()
+	dir := filepath.Join(workDir, "planned")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+
+	err := runCommand(context.Background(), Input{
+		WorkDir: workDir,
+		Sandbox: Sandbox{Mode: SandboxEnv},
+	}, Command{Path: "sh", Args: []string{"-c", `test -z "$GITHUB_API_TOKEN" && test "$MICROPLANE_REPO" = repo && touch "$HOME/x" "$TMPDIR/y"`}}, dir, []string{"MICROPLANE_REPO=repo"})
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(workDir, "sandbox", "home", "x"))
+	assert.FileExists(t, filepath.Join(workDir, "sandbox", "tmp", "y"))
+}
+
+func TestSandboxValidate(t *testing.T) {
+	assert.NoError(t, Sandbox{}.Validate())
+	assert.NoError(t, Sandbox{Mode: SandboxNamespace}.Validate())
+	assert.Error(t, Sandbox{Mode: SandboxContainer}.Validate())
+	assert.NoError(t, Sandbox{Mode: SandboxContainer, Image: "golang"}.Validate())
+	assert.Error(t, Sandbox{Mode: "chroot"}.Validate())
+}
+
+func TestNamespaceMounts(t *testing.T) {
+	home := t.TempDir()
+	clone := t.TempDir()
+	workDir := t.TempDir()
+	dir := filepath.Join(workDir, "planned")
+	writeFiles(t, dir, map[string]string{".git": "gitdir: " + filepath.Join(clone, ".git", "worktrees", "planned") + "\n"})
+
+	args := namespaceMounts(workDir, dir, home)
+	assert.Equal(t, []string{"--ro-bind", "/", "/"}, args[:3])
+	// the home directory is hidden, then the clone's git directory and the WorkDir are mounted over everything
+	i := slices.Index(args, home)
+	require.Positive(t, i)
+	assert.Equal(t, "--tmpfs", args[i-1])
+	assert.Equal(t, []string{"--ro-bind", filepath.Join(clone, ".git"), filepath.Join(clone, ".git"), "--bind", workDir, workDir}, args[len(args)-6:])
+}
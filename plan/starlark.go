@@ -0,0 +1,454 @@
+package plan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/bmatcuk/doublestar/v4"
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+	"gopkg.in/yaml.v3"
+)
+
+// Starlark is an Operation running a Starlark (https://github.com/bazelbuild/starlark) script in the repo.
+// Scripts can only touch the repo's files, so they run the same way in every repo and on every machine.
+//
+// Besides Starlark's built-ins, scripts can use:
+//
+//	fs.read(path), fs.write(path, data), fs.exists(path), fs.remove(path), fs.glob(pattern)
+//	json.encode(value), json.decode(data), json.indent(data)
+//	yaml.encode(value), yaml.decode(data)
+//	repo.name, repo.owner, repo.full_name, repo.default_branch, repo.base_branch, repo.base_sha,
+//	repo.campaign, repo.branch, repo.vars
+//	skip(reason), to leave the repo unchanged
+//	set_value(name, value), to make a value available to the commit message and PR body templates as {{.Values.name}}
+//	load("other.star", "symbol"), to load other scripts next to this one
+//
+// Paths are relative to the repo root.
+type Starlark struct {
+	// Path of the script
+	Path string
+}
+
+var starlarkFileOptions = &syntax.FileOptions{Set: true, While: true, TopLevelControl: true, GlobalReassign: true, Recursion: true}
+
+// NewStarlark checks the script's syntax
+func NewStarlark(path string) (*Starlark, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := starlarkFileOptions.Parse(path, src, 0); err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Starlark{Path: abs}, nil
+}
+
+// modulePath is where load() finds a module: next to the script, even when loaded by another module
+func (s *Starlark) modulePath(module string) string {
+	return filepath.Join(filepath.Dir(s.Path), module)
+}
+
+// files lists the script and the modules it loads, directly or not
+func (s *Starlark) files() ([]string, error) {
+	files := []string{s.Path}
+	seen := map[string]bool{s.Path: true}
+	for i := 0; i < len(files); i++ {
+		src, err := os.ReadFile(files[i])
+		if err != nil {
+			return nil, err
+		}
+		f, err := starlarkFileOptions.Parse(files[i], src, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, stmt := range f.Stmts {
+			load, ok := stmt.(*syntax.LoadStmt)
+			if !ok {
+				continue
+			}
+			if path := s.modulePath(load.ModuleName()); !seen[path] {
+				seen[path] = true
+				files = append(files, path)
+			}
+		}
+	}
+	return files, nil
+}
+
+// Apply runs the script with dir as the repo root
+func (s *Starlark) Apply(ctx context.Context, dir string, changeCtx Context, output *Output) error {
+	var printed bytes.Buffer
+	thread := &starlark.Thread{
+		Name:  changeCtx.FullName,
+		Print: func(_ *starlark.Thread, msg string) { fmt.Fprintln(&printed, msg) },
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel(ctx.Err().Error())
+		case <-done:
+		}
+	}()
+
+	predeclared := starlark.StringDict{
+		"fs":   starlarkFS(dir),
+		"json": starlarkjson.Module,
+		"yaml": starlarkYAML,
+		"repo": starlarkRepo(changeCtx),
+		"set_value": starlark.NewBuiltin("set_value", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var name string
+			var value starlark.Value
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &name, "value", &value); err != nil {
+				return nil, err
+			}
+			// values are kept as JSON, like the ones written by commands
+			encoded, err := starlark.Call(thread, starlarkjson.Module.Members["encode"], starlark.Tuple{value}, nil)
+			if err != nil {
+				return nil, err
+			}
+			var v interface{}
+			if err := json.Unmarshal([]byte(encoded.(starlark.String)), &v); err != nil {
+				return nil, err
+			}
+			output.setValue(name, v)
+			return starlark.None, nil
+		}),
+		"skip": starlark.NewBuiltin("skip", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var reason string
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "reason", &reason); err != nil {
+				return nil, err
+			}
+			output.SkipReason = reason
+			return starlark.None, nil
+		}),
+	}
+
+	// load() resolves scripts next to this one, and runs each once
+	type loaded struct {
+		globals starlark.StringDict
+		err     error
+	}
+	cache := map[string]*loaded{}
+	thread.Load = func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+		path := s.modulePath(module)
+		if l, ok := cache[path]; ok {
+			if l == nil {
+				return nil, fmt.Errorf("cycle in load of %s", module)
+			}
+			return l.globals, l.err
+		}
+		cache[path] = nil
+		globals, err := starlark.ExecFileOptions(starlarkFileOptions, thread, path, nil, predeclared)
+		cache[path] = &loaded{globals, err}
+		return globals, err
+	}
+
+	if _, err := starlark.ExecFileOptions(starlarkFileOptions, thread, s.Path, nil, predeclared); err != nil {
+		var evalErr *starlark.EvalError
+		if errors.As(err, &evalErr) {
+			return fmt.Errorf("%s\n%s", evalErr.Backtrace(), printed.String())
+		}
+		return fmt.Errorf("%s\n%s", err, printed.String())
+	}
+	return nil
+}
+
+func starlarkRepo(c Context) *starlarkstruct.Struct {
+	vars := starlark.NewDict(len(c.Vars))
+	for k, v := range c.Vars {
+		vars.SetKey(starlark.String(k), starlark.String(v))
+	}
+	vars.Freeze()
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"name":           starlark.String(c.Repo.Name),
+		"owner":          starlark.String(c.Repo.Owner),
+		"full_name":      starlark.String(c.FullName),
+		"default_branch": starlark.String(c.DefaultBranch),
+		"base_branch":    starlark.String(c.BaseBranch),
+		"base_sha":       starlark.String(c.BaseSHA),
+		"campaign":       starlark.String(c.Campaign),
+		"branch":         starlark.String(c.BranchName),
+		"vars":           vars,
+	})
+}
+
+func starlarkFS(dir string) *starlarkstruct.Module {
+	// resolve checks that a script's path stays in the repo, also through symlinks
+	resolve := func(fn *starlark.Builtin, path string) (string, error) {
+		if !filepath.IsLocal(path) {
+			return "", fmt.Errorf("%s: path %s is outside the repo", fn.Name(), path)
+		}
+		resolved := filepath.Join(dir, path)
+		if err := inDir(dir, resolved); err != nil {
+			return "", fmt.Errorf("%s: path %s %w", fn.Name(), path, err)
+		}
+		return resolved, nil
+	}
+	pathBuiltin := func(name string, f func(fn *starlark.Builtin, path string) (starlark.Value, error)) *starlark.Builtin {
+		return starlark.NewBuiltin(name, func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var path string
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "path", &path); err != nil {
+				return nil, err
+			}
+			resolved, err := resolve(fn, path)
+			if err != nil {
+				return nil, err
+			}
+			return f(fn, resolved)
+		})
+	}
+
+	return &starlarkstruct.Module{
+		Name: "fs",
+		Members: starlark.StringDict{
+			"read": pathBuiltin("fs.read", func(fn *starlark.Builtin, path string) (starlark.Value, error) {
+				b, err := os.ReadFile(path)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+				}
+				return starlark.String(b), nil
+			}),
+			"exists": pathBuiltin("fs.exists", func(fn *starlark.Builtin, path string) (starlark.Value, error) {
+				_, err := os.Stat(path)
+				return starlark.Bool(err == nil), nil
+			}),
+			"remove": pathBuiltin("fs.remove", func(fn *starlark.Builtin, path string) (starlark.Value, error) {
+				if path == filepath.Clean(dir) {
+					return nil, fmt.Errorf("%s: can't remove the repo itself", fn.Name())
+				}
+				if err := os.RemoveAll(path); err != nil {
+					return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+				}
+				return starlark.None, nil
+			}),
+			"write": starlark.NewBuiltin("fs.write", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var path, data string
+				if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "path", &path, "data", &data); err != nil {
+					return nil, err
+				}
+				resolved, err := resolve(fn, path)
+				if err != nil {
+					return nil, err
+				}
+				mode := os.FileMode(0644)
+				if info, err := os.Stat(resolved); err == nil {
+					mode = info.Mode().Perm()
+				}
+				if err := os.MkdirAll(filepath.Dir(resolved), 0755); err != nil {
+					return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+				}
+				if err := os.WriteFile(resolved, []byte(data), mode); err != nil {
+					return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+				}
+				return starlark.None, nil
+			}),
+			"glob": starlark.NewBuiltin("fs.glob", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var pattern string
+				if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pattern", &pattern); err != nil {
+					return nil, err
+				}
+				if !doublestar.ValidatePattern(pattern) {
+					return nil, fmt.Errorf("%s: invalid pattern %s", fn.Name(), pattern)
+				}
+				files, err := matchFiles(dir, []string{pattern})
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+				}
+				values := []starlark.Value{}
+				for _, f := range files {
+					values = append(values, starlark.String(f))
+				}
+				return starlark.NewList(values), nil
+			}),
+		},
+	}
+}
+
+// inDir checks that path, once its symlinks are resolved, is in dir.
+// Paths that don't exist yet are checked through their deepest existing parent.
+func inDir(dir, path string) error {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	for existing := path; ; existing = filepath.Dir(existing) {
+		real, err := filepath.EvalSymlinks(existing)
+		if errors.Is(err, fs.ErrNotExist) {
+			if _, lerr := os.Lstat(existing); lerr == nil {
+				// a broken symlink, which could be written through to anywhere
+				return fmt.Errorf("is a broken symlink")
+			}
+			if filepath.Dir(existing) != existing {
+				continue
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(realDir, real); err != nil || (rel != "." && !filepath.IsLocal(rel)) {
+			return fmt.Errorf("leads outside the repo through a symlink")
+		}
+		return nil
+	}
+}
+
+var starlarkYAML = &starlarkstruct.Module{
+	Name: "yaml",
+	Members: starlark.StringDict{
+		"decode": starlark.NewBuiltin("yaml.decode", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var data string
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "data", &data); err != nil {
+				return nil, err
+			}
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(data), &doc); err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+			}
+			if len(doc.Content) == 0 {
+				return starlark.None, nil
+			}
+			return fromYAML(doc.Content[0])
+		}),
+		"encode": starlark.NewBuiltin("yaml.encode", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var value starlark.Value
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "value", &value); err != nil {
+				return nil, err
+			}
+			node, err := toYAML(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+			}
+			var buf bytes.Buffer
+			encoder := yaml.NewEncoder(&buf)
+			encoder.SetIndent(2)
+			if err := encoder.Encode(node); err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+			}
+			return starlark.String(buf.String()), nil
+		}),
+	},
+}
+
+// fromYAML converts a YAML node to Starlark values, keeping the order of keys
+func fromYAML(node *yaml.Node) (starlark.Value, error) {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return fromYAML(node.Alias)
+	case yaml.MappingNode:
+		dict := starlark.NewDict(len(node.Content) / 2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, err := fromYAML(node.Content[i])
+			if err != nil {
+				return nil, err
+			}
+			v, err := fromYAML(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			if err := dict.SetKey(k, v); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	case yaml.SequenceNode:
+		values := []starlark.Value{}
+		for _, n := range node.Content {
+			v, err := fromYAML(n)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return starlark.NewList(values), nil
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!null":
+			return starlark.None, nil
+		case "!!bool":
+			var b bool
+			if err := node.Decode(&b); err != nil {
+				return nil, err
+			}
+			return starlark.Bool(b), nil
+		case "!!int":
+			var i big.Int
+			var s string
+			if err := node.Decode(&s); err != nil {
+				return nil, err
+			}
+			if _, ok := i.SetString(s, 0); !ok {
+				return nil, fmt.Errorf("invalid int %s", s)
+			}
+			return starlark.MakeBigInt(&i), nil
+		case "!!float":
+			var f float64
+			if err := node.Decode(&f); err != nil {
+				return nil, err
+			}
+			return starlark.Float(f), nil
+		}
+		return starlark.String(node.Value), nil
+	}
+	return nil, fmt.Errorf("unsupported YAML node %s", node.Tag)
+}
+
+// toYAML converts Starlark values to a YAML node
+func toYAML(value starlark.Value) (*yaml.Node, error) {
+	scalar := func(tag, v string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: v}
+	}
+	switch v := value.(type) {
+	case starlark.NoneType:
+		return scalar("!!null", "null"), nil
+	case starlark.Bool:
+		return scalar("!!bool", strconv.FormatBool(bool(v))), nil
+	case starlark.Int:
+		return scalar("!!int", v.String()), nil
+	case starlark.Float:
+		return scalar("!!float", strconv.FormatFloat(float64(v), 'g', -1, 64)), nil
+	case starlark.String:
+		return scalar("!!str", string(v)), nil
+	case *starlark.Dict:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, item := range v.Items() {
+			k, err := toYAML(item[0])
+			if err != nil {
+				return nil, err
+			}
+			val, err := toYAML(item[1])
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, k, val)
+		}
+		return node, nil
+	case starlark.Indexable:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for i := 0; i < v.Len(); i++ {
+			item, err := toYAML(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, item)
+		}
+		return node, nil
+	}
+	return nil, fmt.Errorf("can't encode %s as YAML", value.Type())
+}
@@ -0,0 +1,106 @@
+package plan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Clever/microplane/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStarlark(t *testing.T) {
+	scripts := t.TempDir()
+	writeFiles(t, scripts, map[string]string{
+		"change.star": `load("lib.star", "set_team")
+
+for path in fs.glob("launch/*.yml"):
+    config = yaml.decode(fs.read(path))
+    fs.write(path, yaml.encode(set_team(config, repo.vars["team"])))
+
+pkg = json.decode(fs.read("package.json"))
+fs.write("owner.txt", repo.full_name + " " + pkg["name"] + "\n")
+set_value("package", pkg["name"])
+`,
+		"lib.star": `def set_team(config, team):
+    config["team"] = team
+    return config
+`,
+	})
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"launch/a.yml": "name: a\nteam: eng-apps\nreplicas: 2\n",
+		"package.json": `{"name": "a"}`,
+	})
+
+	op, err := NewStarlark(filepath.Join(scripts, "change.star"))
+	require.NoError(t, err)
+	changeCtx := Context{Repo: lib.Repo{Owner: "me", Name: "a"}, FullName: "me/a", Vars: map[string]string{"team": "eng-infra"}}
+	output := Output{}
+	require.NoError(t, op.Apply(context.Background(), dir, changeCtx, &output))
+
+	assert.Equal(t, "name: a\nteam: eng-infra\nreplicas: 2\n", readFile(t, filepath.Join(dir, "launch/a.yml")))
+	assert.Equal(t, "me/a a\n", readFile(t, filepath.Join(dir, "owner.txt")))
+	assert.Equal(t, "", output.SkipReason)
+	assert.Equal(t, map[string]interface{}{"package": "a"}, output.Template.Values)
+}
+
+func TestStarlarkSkip(t *testing.T) {
+	scripts := t.TempDir()
+	writeFiles(t, scripts, map[string]string{
+		"skip.star": `if not fs.exists("package.json"):
+    skip("not a node repo")
+`,
+	})
+	op, err := NewStarlark(filepath.Join(scripts, "skip.star"))
+	require.NoError(t, err)
+	output := Output{}
+	require.NoError(t, op.Apply(context.Background(), t.TempDir(), Context{}, &output))
+	assert.Equal(t, "not a node repo", output.SkipReason)
+}
+
+func TestStarlarkErrors(t *testing.T) {
+	scripts := t.TempDir()
+	writeFiles(t, scripts, map[string]string{
+		"escape.star": `print("reading")
+fs.read("../secret")
+`,
+		"syntax.star": "def (\n",
+		"symlink.star": `fs.read("link/secret")
+`,
+		"dangling.star": `fs.write("dangling", "x")
+`,
+		"root.star": `fs.remove(".")
+`,
+	})
+
+	_, err := NewStarlark(filepath.Join(scripts, "syntax.star"))
+	assert.Error(t, err)
+
+	op, err := NewStarlark(filepath.Join(scripts, "escape.star"))
+	require.NoError(t, err)
+	err = op.Apply(context.Background(), t.TempDir(), Context{}, &Output{})
+	assert.ErrorContains(t, err, "path ../secret is outside the repo")
+	assert.ErrorContains(t, err, "reading")
+
+	// symlinks can't lead out of the repo, and the repo can't be removed
+	outside := t.TempDir()
+	writeFiles(t, outside, map[string]string{"secret": "s"})
+	repo := t.TempDir()
+	require.NoError(t, os.Symlink(outside, filepath.Join(repo, "link")))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "new"), filepath.Join(repo, "dangling")))
+	for script, message := range map[string]string{
+		"symlink.star":  "path link/secret leads outside the repo through a symlink",
+		"dangling.star": "path dangling is a broken symlink",
+		"root.star":     "can't remove the repo itself",
+	} {
+		op, err := NewStarlark(filepath.Join(scripts, script))
+		require.NoError(t, err)
+		err = op.Apply(context.Background(), repo, Context{}, &Output{})
+		assert.ErrorContains(t, err, message, script)
+	}
+	assert.NoFileExists(t, filepath.Join(outside, "new"))
+	assert.DirExists(t, repo)
+}
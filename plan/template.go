@@ -0,0 +1,73 @@
+package plan
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// TemplateData is available to the Go templates of the branch name, commit messages and PR body, e.g. `{{.Repo}}`
+type TemplateData struct {
+	Repo          string
+	Owner         string
+	FullName      string
+	DefaultBranch string
+	BaseBranch    string
+	Campaign      string
+	// Vars given for the repo in the repos file passed to `mp init`
+	Vars map[string]string
+	// Values emitted by the change, see valuesFile. Not available to the branch name, which is rendered before the change.
+	Values map[string]interface{}
+}
+
+// valuesFile is where the change command may write a JSON object of values for the templates, relative to the WorkDir.
+// Its path is passed to the command as MICROPLANE_VALUES.
+const valuesFile = "values.json"
+
+// CheckTemplate parses a template, to report its errors before planning
+func CheckTemplate(name, text string) error {
+	_, err := template.New(name).Option("missingkey=error").Parse(text)
+	return err
+}
+
+// RenderTemplate renders a template of the branch name, a commit message or the PR body
+func RenderTemplate(name, text string, data TemplateData) (string, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// loadValues adds the values written by the change command to output
+func loadValues(workDir string, output *Output) error {
+	b, err := os.ReadFile(filepath.Join(workDir, valuesFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(b, &values); err != nil {
+		return fmt.Errorf("invalid %s, must be a JSON object: %w", valuesFile, err)
+	}
+	for k, v := range values {
+		output.setValue(k, v)
+	}
+	return nil
+}
+
+func (o *Output) setValue(key string, value interface{}) {
+	if o.Template.Values == nil {
+		o.Template.Values = map[string]interface{}{}
+	}
+	o.Template.Values[key] = value
+}
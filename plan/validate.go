@@ -0,0 +1,37 @@
+package plan
+
+import (
+	"context"
+)
+
+// Validation is the result of running one of the repo's checks on the planned change
+type Validation struct {
+	Command string
+	Passed  bool
+	Error   string `json:",omitempty"`
+}
+
+// validate runs every check in dir, after the change is committed. A failing check doesn't stop the others.
+func validate(ctx context.Context, input Input, dir string, extraEnv []string) []Validation {
+	validations := []Validation{}
+	for _, check := range input.Validate {
+		v := Validation{Command: check, Passed: true}
+		if err := runCommand(ctx, input, Command{Path: "sh", Args: []string{"-c", check}}, dir, extraEnv); err != nil {
+			v.Passed = false
+			v.Error = err.Error()
+		}
+		validations = append(validations, v)
+	}
+	return validations
+}
+
+// FailedValidations lists the checks the planned change didn't pass
+func (o Output) FailedValidations() []string {
+	failed := []string{}
+	for _, v := range o.Validations {
+		if !v.Passed {
+			failed = append(failed, v.Command)
+		}
+	}
+	return failed
+}
@@ -5,20 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
-	"os/exec"
 	"strings"
 	"time"
 
+	"github.com/Clever/microplane/git"
 	"github.com/Clever/microplane/lib"
 	"github.com/google/go-github/v35/github"
 )
 
-// Command represents a command to run.
-type Command struct {
-	Path string
-	Args []string
-}
-
 // Input to Push()
 type Input struct {
 	// Repo is the git repo
@@ -37,10 +31,14 @@ type Input struct {
 	PRAssignee string
 	// BranchName is the branch name in Git
 	BranchName string
+	// BaseBranch is the branch the PR merges into. Defaults to the repo's default branch.
+	BaseBranch string
 	// Labels
 	Labels []string
 	// Draft controls whether it should be a draft PR
 	Draft bool
+	// Git pushes the planned commit
+	Git git.Git
 }
 
 // Output from Push()
@@ -83,31 +81,21 @@ func GithubPush(ctx context.Context, input Input, repoLimiter *time.Ticker, push
 		return Output{}, err
 	}
 
-	// Get the commit SHA from the last commit
-	cmd := Command{Path: "git", Args: []string{"log", "-1", "--pretty=format:%H"}}
-	gitLog := exec.CommandContext(ctx, cmd.Path, cmd.Args...)
-	gitLog.Dir = input.PlanDir
-	gitLogOutput, err := gitLog.CombinedOutput()
-	if err != nil {
-		return Output{Success: false}, errors.New(string(gitLogOutput))
-	}
-
 	// Push the commit
-	gitHeadBranch := fmt.Sprintf("HEAD:%s", input.BranchName)
-	cmd = Command{Path: "git", Args: []string{"push", "-f", "origin", gitHeadBranch}}
-	gitPush := exec.CommandContext(ctx, cmd.Path, cmd.Args...)
-	gitPush.Dir = input.PlanDir
-	if output, err := gitPush.CombinedOutput(); err != nil {
-		return Output{Success: false}, errors.New(string(output))
+	if err := input.Git.Push(ctx, input.PlanDir, input.BranchName); err != nil {
+		return Output{Success: false}, err
 	}
 
 	// Open a pull request, if one doesn't exist already
 	head := fmt.Sprintf("%s:%s", input.Repo.Owner, input.BranchName)
-	repository, _, err := client.Repositories.Get(ctx, input.Repo.Owner, input.Repo.Name)
-	if err != nil {
-		return Output{Success: false}, err
+	base := input.BaseBranch
+	if base == "" {
+		repository, _, err := client.Repositories.Get(ctx, input.Repo.Owner, input.Repo.Name)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+		base = *repository.DefaultBranch
 	}
-	base := *repository.DefaultBranch
 
 	title, body := getTitleBody(input)
 	pr, err := findOrCreatePR(ctx, client, input.Repo.Owner, input.Repo.Name, &github.NewPullRequest{
@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os/exec"
 	"strings"
 	"time"
 
@@ -21,32 +20,21 @@ func GitlabPush(ctx context.Context, input Input, repoLimiter *time.Ticker, push
 		return Output{}, err
 	}
 
-	// Get the commit SHA from the last commit
-	cmd := Command{Path: "git", Args: []string{"log", "-1", "--pretty=format:%H"}}
-	gitLog := exec.CommandContext(ctx, cmd.Path, cmd.Args...)
-	gitLog.Dir = input.PlanDir
-	gitLogOutput, err := gitLog.CombinedOutput()
-	if err != nil {
-		return Output{Success: false}, errors.New(string(gitLogOutput))
-	}
-
 	// Push the commit
-	gitHeadBranch := fmt.Sprintf("HEAD:%s", input.BranchName)
-	cmd = Command{Path: "git", Args: []string{"push", "-f", "origin", gitHeadBranch}}
-	gitPush := exec.CommandContext(ctx, cmd.Path, cmd.Args...)
-	gitPush.Dir = input.PlanDir
-	if output, err := gitPush.CombinedOutput(); err != nil {
-		return Output{Success: false}, errors.New(string(output))
-	}
-
-	project, _, err := client.Projects.GetProject(fmt.Sprintf("%s/%s", input.Repo.Owner, input.Repo.Name), nil)
-	if err != nil {
+	if err := input.Git.Push(ctx, input.PlanDir, input.BranchName); err != nil {
 		return Output{Success: false}, err
 	}
 
 	// Open a pull request, if one doesn't exist already
 	head := input.BranchName
-	base := project.DefaultBranch
+	base := input.BaseBranch
+	if base == "" {
+		project, _, err := client.Projects.GetProject(fmt.Sprintf("%s/%s", input.Repo.Owner, input.Repo.Name), nil)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+		base = project.DefaultBranch
+	}
 
 	title, body := getTitleBody(input)
 	pr, err := findOrCreateGitlabMR(ctx, client, input.Repo.Owner, input.Repo.Name, &gitlab.CreateMergeRequestOptions{
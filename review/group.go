@@ -0,0 +1,85 @@
+package review
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Clever/microplane/plan"
+)
+
+// Planned is a repo's planned change, for grouping
+type Planned struct {
+	// Name identifies the repo, e.g. "owner/name"
+	Name string
+	// Owner and Repo are replaced by placeholders in the diff, so that repo-specific paths compare equal
+	Owner string
+	Repo  string
+	Diff  string
+	// DiffSHA identifies Diff, to record review decisions on it
+	DiffSHA string
+}
+
+// Group is a set of repos whose planned diffs are identical once normalized
+type Group struct {
+	Repos []Planned
+	// Normalized diff shared by the repos
+	Normalized string
+	Files      int
+	Added      int
+	Deleted    int
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(,\d+)? \+\d+(,\d+)? @@`)
+
+// Normalize strips what differs between repos making the same change: blob hashes, hunk offsets,
+// and the repo's owner and name, e.g. in paths
+func Normalize(diff, owner, repo string) string {
+	lines := []string{}
+	for _, line := range strings.Split(diff, "\n") {
+		if strings.HasPrefix(line, "index ") {
+			continue
+		}
+		lines = append(lines, hunkHeader.ReplaceAllString(line, "@@"))
+	}
+	normalized := strings.Join(lines, "\n")
+	for _, r := range [][2]string{{repo, "{repo}"}, {owner, "{owner}"}} {
+		name, placeholder := r[0], r[1]
+		if name == "" {
+			continue
+		}
+		// names may contain '-' and '.', so only replace them as a whole
+		word := regexp.MustCompile(`(^|[^\w.-])` + regexp.QuoteMeta(name) + `([^\w.-]|$)`)
+		normalized = word.ReplaceAllString(normalized, "${1}"+placeholder+"${2}")
+	}
+	return normalized
+}
+
+// GroupDiffs clusters repos with identical normalized diffs, largest groups first
+func GroupDiffs(planned []Planned) []Group {
+	byDiff := map[string]*Group{}
+	for _, p := range planned {
+		normalized := Normalize(p.Diff, p.Owner, p.Repo)
+		g, ok := byDiff[normalized]
+		if !ok {
+			g = &Group{Normalized: normalized}
+			stat := plan.ParseDiffStat(p.Diff)
+			g.Files, g.Added, g.Deleted = len(stat.Files), stat.Insertions, stat.Deletions
+			byDiff[normalized] = g
+		}
+		g.Repos = append(g.Repos, p)
+	}
+
+	groups := []Group{}
+	for _, g := range byDiff {
+		sort.Slice(g.Repos, func(i, j int) bool { return g.Repos[i].Name < g.Repos[j].Name })
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if len(groups[i].Repos) != len(groups[j].Repos) {
+			return len(groups[i].Repos) > len(groups[j].Repos)
+		}
+		return groups[i].Repos[0].Name < groups[j].Repos[0].Name
+	})
+	return groups
+}
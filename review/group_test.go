@@ -0,0 +1,37 @@
+package review
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupDiffs(t *testing.T) {
+	diff := func(path, index string, line int) string {
+		return "diff --git a/" + path + " b/" + path + "\nindex " + index + " 100644\n--- a/" + path + "\n+++ b/" + path +
+			"\n@@ -" + string(rune('0'+line)) + ",2 +" + string(rune('0'+line)) + ",2 @@ func main() {\n-old\n+new\n"
+	}
+	groups := GroupDiffs([]Planned{
+		{Name: "me/web", Owner: "me", Repo: "web", Diff: diff("cmd/web/main.go", "111..222", 1)},
+		{Name: "me/api", Owner: "me", Repo: "api", Diff: diff("cmd/api/main.go", "333..444", 5)},
+		{Name: "me/worker", Owner: "me", Repo: "worker", Diff: diff("cmd/other/main.go", "333..444", 5)},
+	})
+
+	require.Len(t, groups, 2)
+	require.Len(t, groups[0].Repos, 2)
+	assert.Equal(t, "me/api", groups[0].Repos[0].Name)
+	assert.Equal(t, "me/web", groups[0].Repos[1].Name)
+	assert.Equal(t, 1, groups[0].Files)
+	assert.Equal(t, 1, groups[0].Added)
+	assert.Equal(t, 1, groups[0].Deleted)
+	assert.Contains(t, groups[0].Normalized, "a/cmd/{repo}/main.go")
+	assert.Contains(t, groups[0].Normalized, "\n@@ func main() {\n")
+	assert.NotContains(t, groups[0].Normalized, "index")
+	assert.Equal(t, "me/worker", groups[1].Repos[0].Name)
+}
+
+func TestNormalize(t *testing.T) {
+	// a name is only replaced as a whole
+	assert.Equal(t, "+{owner}/{repo} api-gateway api.v2 {repo}", Normalize("+clever/api api-gateway api.v2 api", "clever", "api"))
+}
@@ -0,0 +1,77 @@
+package review
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// Decisions on a planned change
+const (
+	Approved = "approved"
+	Rejected = "rejected"
+)
+
+// Output of reviewing a repo's planned change
+type Output struct {
+	Decision string
+	// DiffSHA identifies the reviewed diff, so that the decision doesn't carry over to a different plan
+	DiffSHA string
+}
+
+// New records a decision on a diff, identified by its plan.Output.DiffSHA
+func New(decision, diffSHA string) Output {
+	return Output{Decision: decision, DiffSHA: diffSHA}
+}
+
+// DecisionFor returns the decision made on the diff identified by diffSHA, or "" if it wasn't reviewed
+func (o Output) DecisionFor(diffSHA string) string {
+	if o.DiffSHA == "" || o.DiffSHA != diffSHA {
+		return ""
+	}
+	return o.Decision
+}
+
+// Colorize colors a git diff's headers, hunks, additions and deletions
+func Colorize(diff string) string {
+	lines := strings.Split(diff, "\n")
+	for i, line := range lines {
+		lines[i] = colorizeLine(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CopyColorized copies a git diff to w line by line, colored like Colorize, without reading it all in memory
+func CopyColorized(w io.Writer, diff io.Reader) error {
+	r := bufio.NewReader(diff)
+	for {
+		line, err := r.ReadString('\n')
+		if line != "" {
+			trimmed := strings.TrimSuffix(line, "\n")
+			if _, werr := io.WriteString(w, colorizeLine(trimmed)+line[len(trimmed):]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func colorizeLine(line string) string {
+	switch {
+	case strings.HasPrefix(line, "diff --git"), strings.HasPrefix(line, "+++ "), strings.HasPrefix(line, "--- "):
+		return color.New(color.Bold).Sprint(line)
+	case strings.HasPrefix(line, "@@"):
+		return color.CyanString(line)
+	case strings.HasPrefix(line, "+"):
+		return color.GreenString(line)
+	case strings.HasPrefix(line, "-"):
+		return color.RedString(line)
+	}
+	return line
+}
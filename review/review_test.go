@@ -0,0 +1,37 @@
+package review
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecisionFor(t *testing.T) {
+	o := New(Approved, "sha-a")
+	assert.Equal(t, Approved, o.DecisionFor("sha-a"))
+	assert.Equal(t, "", o.DecisionFor("sha-b"))
+	assert.Equal(t, "", Output{}.DecisionFor("sha-a"))
+	assert.Equal(t, "", Output{Decision: Approved}.DecisionFor(""))
+}
+
+func TestColorize(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = false
+	defer func() { color.NoColor = noColor }()
+
+	diff := "diff --git a/a b/a\n--- a/a\n+++ b/a\n@@ -1 +1 @@\n-old\n+new\n same"
+	colorized := Colorize(diff)
+	assert.Contains(t, colorized, color.RedString("-old"))
+	assert.Contains(t, colorized, color.GreenString("+new"))
+	assert.Contains(t, colorized, color.CyanString("@@ -1 +1 @@"))
+	assert.NotContains(t, colorized, color.RedString("--- a/a"))
+	assert.Contains(t, colorized, "\n same")
+
+	var copied bytes.Buffer
+	require.NoError(t, CopyColorized(&copied, strings.NewReader(diff+"\n")))
+	assert.Equal(t, colorized+"\n", copied.String())
+}